@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Neurocoda/Antimg/bench"
+	"github.com/Neurocoda/Antimg/services"
+)
+
+// runBench 执行 bench 子命令，返回进程退出码
+// 用法: antimg bench -dir ./corpus -out report.csv [-presets a,b] [-levels 0.25,0.5] [-watermarks dct,dwt]
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	dir := fs.String("dir", "", "图片目录（必填），递归查找图片")
+	out := fs.String("out", "", "报告输出文件，为空时写到标准输出")
+	format := fs.String("format", "", "报告格式 csv 或 json，为空时按 -out 的扩展名决定，默认 csv")
+	presets := fs.String("presets", "", "逗号分隔的预设名称，default 表示默认处理流程；为空时测试全部")
+	levels := fs.String("levels", "0.25,0.5,0.75,1", "逗号分隔的攻击强度")
+	watermarks := fs.String("watermarks", "", "逗号分隔的参考水印算法；为空时测试全部")
+	presetsFile := fs.String("presets-file", "", "额外加载的自定义预设文件")
+	seed := fs.Int64("seed", 1, "攻击随机种子")
+	key := fs.Int64("key", 1, "水印密钥")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "bench: 必须通过 -dir 指定图片目录")
+		fs.Usage()
+		return 2
+	}
+
+	cfg := bench.Config{
+		Dir:        *dir,
+		Presets:    splitList(*presets),
+		Watermarks: splitList(*watermarks),
+		Seed:       *seed,
+		Key:        *key,
+	}
+	for _, s := range splitList(*levels) {
+		level, err := strconv.ParseFloat(s, 64)
+		if err != nil || level < 0 || level > 1 {
+			fmt.Fprintf(os.Stderr, "bench: 无效的攻击强度 %q，必须在0.0-1.0之间\n", s)
+			return 2
+		}
+		cfg.Levels = append(cfg.Levels, level)
+	}
+
+	if *format == "" {
+		*format = "csv"
+		if strings.EqualFold(filepath.Ext(*out), ".json") {
+			*format = "json"
+		}
+	}
+	write := bench.WriteCSV
+	switch *format {
+	case "csv":
+	case "json":
+		write = bench.WriteJSON
+	default:
+		fmt.Fprintln(os.Stderr, "bench: 报告格式仅支持 csv 或 json")
+		return 2
+	}
+
+	if *presetsFile != "" {
+		if _, err := services.LoadPresetFile(*presetsFile); err != nil {
+			fmt.Fprintln(os.Stderr, "bench: 加载预设配置失败:", err)
+			return 1
+		}
+	}
+
+	rows, err := bench.Run(context.Background(), cfg, func(image string, index, total int) {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", index, total, image)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bench:", err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bench:", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(w, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "bench: 写入报告失败:", err)
+		return 1
+	}
+	failed := 0
+	for _, r := range rows {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "bench: 共 %d 条结果，其中 %d 条失败\n", len(rows), failed)
+	return 0
+}
+
+// splitList 拆分逗号分隔的列表，忽略空项
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,225 @@
+// Package bench 在本地图片目录上批量运行攻击预设和强度组合，
+// 用参考水印统计每种组合的画面损伤（PSNR、SSIM）和水印误码率
+package bench
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/Neurocoda/Antimg/codec"
+	"github.com/Neurocoda/Antimg/services"
+	"github.com/Neurocoda/Antimg/watermark"
+)
+
+// DefaultPipelineName 报告中表示默认处理流程（不使用预设）的名称
+const DefaultPipelineName = "default"
+
+// Config 基准测试参数
+type Config struct {
+	Dir        string    // 图片目录，递归查找可识别的图片文件
+	Presets    []string  // 参与测试的预设，为空时使用全部预设和默认处理流程
+	Levels     []float64 // 攻击强度
+	Watermarks []string  // 参考水印算法，为空时使用全部算法
+	Seed       int64     // 攻击随机种子，固定后结果可复现
+	Key        int64     // 水印密钥
+}
+
+// Row 单个图片、预设、强度和水印算法组合的结果；
+// 该组合无法评估时（如图片太小、无法解码）只填写 Error，图片无法解码时预设和算法为空
+type Row struct {
+	Image     string  `json:"image"`
+	Preset    string  `json:"preset"`
+	Level     float64 `json:"level"`
+	Watermark string  `json:"watermark"`
+	PSNR      float64 `json:"psnr"`
+	SSIM      float64 `json:"ssim"`
+	MSSSIM    float64 `json:"ms_ssim"`
+	EmbedPSNR float64 `json:"embed_psnr"`
+	BER       float64 `json:"ber"`
+	Detected  bool    `json:"detected"`
+	AttackMS  float64 `json:"attack_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Run 执行基准测试，progress 在开始处理每张图片时回调，可为空；
+// 单张图片或单个组合失败时记录在对应行的 Error 中并继续，只有 ctx 结束时中止
+func Run(ctx context.Context, cfg Config, progress func(image string, index, total int)) ([]Row, error) {
+	files, err := findImages(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("目录 %s 中没有可识别的图片", cfg.Dir)
+	}
+
+	presets := cfg.Presets
+	if len(presets) == 0 {
+		presets = []string{DefaultPipelineName}
+		for _, p := range services.ListPresets() {
+			presets = append(presets, p.Name)
+		}
+	}
+	pipelines := make([]services.Pipeline, len(presets))
+	for i, name := range presets {
+		if name == DefaultPipelineName {
+			continue
+		}
+		preset, ok := services.GetPreset(name)
+		if !ok {
+			return nil, fmt.Errorf("未知的预设: %s", name)
+		}
+		pipelines[i] = preset.Stages
+	}
+
+	schemes := cfg.Watermarks
+	if len(schemes) == 0 {
+		schemes = watermark.Names()
+	}
+	for _, name := range schemes {
+		if _, ok := watermark.Get(name); !ok {
+			return nil, fmt.Errorf("未知的水印算法: %s", name)
+		}
+	}
+
+	// 不限制超时和像素数，由调用方挑选合适的测试图片
+	service := services.NewImageService(0, services.PixelLimit{})
+	var rows []Row
+	for i, file := range files {
+		if progress != nil {
+			progress(file, i+1, len(files))
+		}
+		img, err := decodeFile(filepath.Join(cfg.Dir, file))
+		if err != nil {
+			rows = append(rows, Row{Image: file, Error: err.Error()})
+			continue
+		}
+
+		for p, preset := range presets {
+			for _, level := range cfg.Levels {
+				// 逐个算法评估，一个算法失败（如容量不足）不影响其他算法
+				for _, scheme := range schemes {
+					seed, key := cfg.Seed, cfg.Key
+					result, err := service.EvaluateImage(ctx, img, services.EvaluateOptions{
+						Process: services.ProcessOptions{
+							AttackLevel: level,
+							Pipeline:    pipelines[p],
+							Seed:        &seed,
+						},
+						Schemes: []string{scheme},
+						Key:     &key,
+					})
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					if err != nil {
+						rows = append(rows, Row{Image: file, Preset: preset, Level: level, Watermark: scheme, Error: err.Error()})
+						continue
+					}
+					r := result.Reports[0]
+					rows = append(rows, Row{
+						Image:     file,
+						Preset:    preset,
+						Level:     level,
+						Watermark: r.Scheme,
+						PSNR:      r.Metrics.PSNR,
+						SSIM:      r.Metrics.SSIM,
+						MSSSIM:    r.Metrics.MSSSIM,
+						EmbedPSNR: r.EmbedPSNR,
+						BER:       r.BER,
+						Detected:  r.Detected,
+						AttackMS:  r.AttackMS,
+					})
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+// findImages 递归查找目录中按文件头可识别的图片，返回相对路径（已排序）
+func findImages(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		head := make([]byte, codec.SniffLen)
+		n, _ := io.ReadFull(f, head)
+		if codec.Sniff(head[:n]) == "" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// decodeFile 解码图片文件，与服务端一致地按 EXIF 方向和 ICC 配置文件校正
+func decodeFile(path string) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, meta, err := codec.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if p, err := codec.ParseICC(meta.ICC); err == nil {
+		img = p.ToSRGB(img)
+	}
+	return img, nil
+}
+
+// csvHeader CSV 报告的列
+var csvHeader = []string{"image", "preset", "level", "watermark", "psnr", "ssim", "ms_ssim", "embed_psnr", "ber", "detected", "attack_ms", "error"}
+
+// WriteCSV 以 CSV 格式写出报告
+func WriteCSV(w io.Writer, rows []Row) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, r := range rows {
+		record := []string{
+			r.Image, r.Preset, f(r.Level), r.Watermark,
+			f(r.PSNR), f(r.SSIM), f(r.MSSSIM), f(r.EmbedPSNR), f(r.BER),
+			strconv.FormatBool(r.Detected), f(r.AttackMS), r.Error,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON 以 JSON 数组格式写出报告
+func WriteJSON(w io.Writer, rows []Row) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if rows == nil {
+		rows = []Row{}
+	}
+	return encoder.Encode(rows)
+}
@@ -0,0 +1,80 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePNG 在 dir 中写入 w×h 的渐变 PNG
+func writePNG(t *testing.T, dir, name string, w, h int) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 无法解码或容量不足的图片记录在行的 Error 中，不会中止整个测试
+func TestRunRecordsPerImageErrors(t *testing.T) {
+	dir := t.TempDir()
+	writePNG(t, dir, "large.png", 128, 128)
+	writePNG(t, dir, "tiny.png", 16, 16)
+	// 文件头可识别但内容损坏
+	if err := os.WriteFile(filepath.Join(dir, "broken.png"), []byte("\x89PNG\r\n\x1a\n broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := Run(context.Background(), Config{
+		Dir:     dir,
+		Presets: []string{"document-safe"},
+		Levels:  []float64{0.5},
+		Seed:    1,
+		Key:     1,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := make(map[string]int)
+	total := make(map[string]int)
+	for _, r := range rows {
+		total[r.Image]++
+		if r.Error != "" {
+			failed[r.Image]++
+		}
+	}
+	if total["broken.png"] != 1 || failed["broken.png"] != 1 {
+		t.Errorf("broken.png: %d 行，%d 行失败，期望 1 行失败记录", total["broken.png"], failed["broken.png"])
+	}
+	if failed["tiny.png"] == 0 {
+		t.Error("tiny.png: 期望容量不足的算法记录错误")
+	}
+	if total["large.png"] == 0 || failed["large.png"] != 0 || total["tiny.png"] != total["large.png"] {
+		t.Errorf("large.png: %d 行，%d 行失败；tiny.png: %d 行", total["large.png"], failed["large.png"], total["tiny.png"])
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	dir := t.TempDir()
+	writePNG(t, dir, "a.png", 64, 64)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Run(ctx, Config{Dir: dir, Levels: []float64{0.5}}, nil); err == nil {
+		t.Error("ctx 结束时应返回错误")
+	}
+}
@@ -0,0 +1,90 @@
+package codec
+
+import (
+	"bytes"
+	"image"
+
+	"github.com/disintegration/imaging"
+
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Decode 解码图片并读取元数据，像素按 EXIF 方向校正为正常朝向
+func Decode(data []byte) (image.Image, string, Metadata, error) {
+	img, format, err := image.Decode(bytes.NewReader(sanitizeWebP(data)))
+	if err != nil {
+		return nil, "", Metadata{}, err
+	}
+
+	meta := ReadMetadata(data, format)
+	return applyOrientation(img, EXIFOrientation(meta.EXIF)), format, meta, nil
+}
+
+// DecodeConfig 只读取图片头部，返回声明的尺寸和格式
+func DecodeConfig(data []byte) (image.Config, string, error) {
+	return image.DecodeConfig(bytes.NewReader(sanitizeWebP(data)))
+}
+
+// applyOrientation 按 EXIF 方向标签（1-8）变换图片
+func applyOrientation(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// sanitizeWebP 移除 golang.org/x/image/webp 无法识别的扩展块（ICCP、EXIF、XMP 等），
+// 元数据由 ReadMetadata 从原始数据中单独读取
+func sanitizeWebP(data []byte) []byte {
+	chunks := webpChunks(data)
+	if len(chunks) == 0 || chunks[0].id != "VP8X" || len(chunks[0].data) != 10 {
+		return data
+	}
+
+	var alph, frame *webpChunk
+	for i := range chunks {
+		switch chunks[i].id {
+		case "ALPH":
+			alph = &chunks[i]
+		case "VP8 ", "VP8L":
+			frame = &chunks[i]
+		case "ANIM":
+			return data // 动画不支持，交由解码器报错
+		}
+	}
+	if frame == nil {
+		return data
+	}
+
+	// 有损图像带独立透明度时保留仅含 alpha 标志的 VP8X 头，否则退化为简单格式
+	out := []webpChunk{*frame}
+	if alph != nil && frame.id == "VP8 " {
+		vp8x := append([]byte(nil), chunks[0].data...)
+		vp8x[0] = 1 << 4
+		out = []webpChunk{{id: "VP8X", data: vp8x}, *alph, *frame}
+	}
+
+	var buf bytes.Buffer
+	if err := writeRIFF(&buf, out); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
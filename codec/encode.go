@@ -0,0 +1,148 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// DefaultJPEGQuality 未指定质量时的JPEG质量
+const DefaultJPEGQuality = 90
+
+// Options 输出编码参数
+type Options struct {
+	Format         string // 输出格式，为空时保持输入格式
+	Quality        int    // JPEG 质量 1-100，0 表示默认值
+	Progressive    bool   // 渐进式JPEG
+	Subsampling    ChromaSubsampling
+	PNGCompression png.CompressionLevel
+
+	MetadataPolicy MetadataPolicy // 元数据处理策略
+	Metadata       Metadata       // 按策略筛选后需要写入的元数据，仅 JPEG、PNG、WebP 支持
+	ICCMode        ICCMode        // ICC 配置文件的处理方式，为空时由元数据策略决定
+}
+
+// OutputFormat 返回实际输出格式
+func (o Options) OutputFormat(inputFormat string) string {
+	if o.Format != "" {
+		return o.Format
+	}
+	if format, err := ParseFormat(inputFormat); err == nil {
+		return format
+	}
+	return "jpeg"
+}
+
+// ParseFormat 规范化格式名称，如 "jpg" -> "jpeg"、"tif" -> "tiff"
+func ParseFormat(name string) (string, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "jpeg", "jpg":
+		return "jpeg", nil
+	case "png":
+		return "png", nil
+	case "bmp":
+		return "bmp", nil
+	case "webp":
+		return "webp", nil
+	case "tiff", "tif":
+		return "tiff", nil
+	}
+	return "", errors.New("输出格式仅支持 jpeg、png、bmp、webp、tiff")
+}
+
+// SupportsAlpha 格式能否保存透明度，为空（保持输入格式）时视为支持
+func SupportsAlpha(format string) bool {
+	return format != "jpeg" && format != "jpg"
+}
+
+// MIMEType 返回格式对应的 Content-Type
+func MIMEType(format string) string {
+	switch format {
+	case "jpeg", "jpg":
+		return "image/jpeg"
+	case "png":
+		return "image/png"
+	case "bmp":
+		return "image/bmp"
+	case "webp":
+		return "image/webp"
+	case "tiff":
+		return "image/tiff"
+	}
+	return "application/octet-stream"
+}
+
+// Extension 返回格式的常用扩展名（不含点）
+func Extension(format string) string {
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
+
+// ParsePNGCompression 解析PNG压缩级别: default、none、fast、best
+func ParsePNGCompression(s string) (png.CompressionLevel, error) {
+	switch strings.ToLower(s) {
+	case "", "default":
+		return png.DefaultCompression, nil
+	case "none":
+		return png.NoCompression, nil
+	case "fast":
+		return png.BestSpeed, nil
+	case "best":
+		return png.BestCompression, nil
+	}
+	return 0, errors.New("PNG压缩级别仅支持 default、none、fast、best")
+}
+
+// Encode 按格式和参数编码图片
+func Encode(w io.Writer, format string, img image.Image, opts Options) error {
+	quality := opts.Quality
+	if quality == 0 {
+		quality = DefaultJPEGQuality
+	}
+	jpegOpts := JPEGOptions{
+		Quality:     quality,
+		Progressive: opts.Progressive,
+		Subsampling: opts.Subsampling,
+	}
+
+	switch format {
+	case "jpeg", "jpg":
+		if opts.Metadata.Empty() {
+			return EncodeJPEG(w, img, jpegOpts)
+		}
+		var buf bytes.Buffer
+		if err := EncodeJPEG(&buf, img, jpegOpts); err != nil {
+			return err
+		}
+		_, err := w.Write(embedJPEGMetadata(buf.Bytes(), opts.Metadata))
+		return err
+	case "png":
+		encoder := png.Encoder{CompressionLevel: opts.PNGCompression}
+		if opts.Metadata.Empty() {
+			return encoder.Encode(w, img)
+		}
+		var buf bytes.Buffer
+		if err := encoder.Encode(&buf, img); err != nil {
+			return err
+		}
+		_, err := w.Write(embedPNGMetadata(buf.Bytes(), opts.Metadata))
+		return err
+	case "bmp":
+		return bmp.Encode(w, img)
+	case "tiff":
+		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+	case "webp":
+		return encodeWebP(w, img, opts.Metadata)
+	default:
+		// 默认使用JPEG格式输出
+		return EncodeJPEG(w, img, jpegOpts)
+	}
+}
@@ -0,0 +1,207 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// EXIF 数据为 TIFF 结构：8字节文件头后跟随若干 IFD（图像文件目录），
+// 每个 IFD 由条目数、12字节的条目和下一个 IFD 的偏移组成，
+// 超过4字节的值存放在条目之外，由偏移引用。
+
+const (
+	exifTagOrientation = 0x0112
+	exifTagArtist      = 0x013b
+	exifTagCopyright   = 0x8298
+	exifTagExifIFD     = 0x8769
+	exifTagGPSIFD      = 0x8825
+	exifTagInteropIFD  = 0xa005
+
+	exifMaxEntries = 1000 // 单个 IFD 条目数上限，防止畸形数据
+	exifMaxDepth   = 4
+)
+
+// exifTypeSizes 各数据类型的字节长度
+var exifTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4,
+}
+
+var errInvalidEXIF = errors.New("exif: 数据格式无效")
+
+// exifEntry 单个 IFD 条目，value 为原始字节序的值数据
+type exifEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+	sub   []exifEntry // 子 IFD（Exif、GPS、Interop）的条目
+}
+
+// exifData 解析后的 EXIF，只保留 IFD0 及其子 IFD，缩略图所在的 IFD1 被丢弃
+type exifData struct {
+	order binary.ByteOrder
+	ifd0  []exifEntry
+}
+
+func parseEXIF(data []byte) (*exifData, error) {
+	if len(data) < 8 {
+		return nil, errInvalidEXIF
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errInvalidEXIF
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, errInvalidEXIF
+	}
+
+	ifd0, err := parseIFD(data, order, order.Uint32(data[4:]), 0)
+	if err != nil {
+		return nil, err
+	}
+	return &exifData{order: order, ifd0: ifd0}, nil
+}
+
+func parseIFD(data []byte, order binary.ByteOrder, offset uint32, depth int) ([]exifEntry, error) {
+	if depth > exifMaxDepth || uint64(offset)+2 > uint64(len(data)) {
+		return nil, errInvalidEXIF
+	}
+	n := uint32(order.Uint16(data[offset:]))
+	if n > exifMaxEntries || uint64(offset)+2+uint64(n)*12 > uint64(len(data)) {
+		return nil, errInvalidEXIF
+	}
+
+	entries := make([]exifEntry, 0, n)
+	for i := uint32(0); i < n; i++ {
+		p := data[offset+2+i*12:]
+		e := exifEntry{
+			tag:   order.Uint16(p[0:]),
+			typ:   order.Uint16(p[2:]),
+			count: order.Uint32(p[4:]),
+		}
+		size, ok := exifTypeSizes[e.typ]
+		if !ok {
+			continue // 未知类型无法确定长度，直接丢弃
+		}
+		total := uint64(size) * uint64(e.count)
+		if total <= 4 {
+			e.value = append([]byte(nil), p[8:8+total]...)
+		} else {
+			start := uint64(order.Uint32(p[8:]))
+			if start+total > uint64(len(data)) {
+				continue
+			}
+			e.value = append([]byte(nil), data[start:start+total]...)
+		}
+
+		switch e.tag {
+		case exifTagExifIFD, exifTagGPSIFD, exifTagInteropIFD:
+			if e.count != 1 || len(e.value) != 4 {
+				continue
+			}
+			sub, err := parseIFD(data, order, order.Uint32(e.value), depth+1)
+			if err != nil {
+				continue
+			}
+			e.sub = sub
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// encode 按原字节序重新生成 TIFF 结构
+func (x *exifData) encode() []byte {
+	buf := make([]byte, 8)
+	if x.order == binary.LittleEndian {
+		copy(buf, "II")
+	} else {
+		copy(buf, "MM")
+	}
+	x.order.PutUint16(buf[2:], 42)
+	x.order.PutUint32(buf[4:], 8)
+	return x.writeIFD(buf, x.ifd0)
+}
+
+// writeIFD 在 buf 末尾写入一个 IFD 及其值数据和子 IFD
+func (x *exifData) writeIFD(buf []byte, entries []exifEntry) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, 2+12*len(entries)+4)...)
+	x.order.PutUint16(buf[start:], uint16(len(entries)))
+
+	for i, e := range entries {
+		p := start + 2 + 12*i
+		x.order.PutUint16(buf[p:], e.tag)
+		x.order.PutUint16(buf[p+2:], e.typ)
+		x.order.PutUint32(buf[p+4:], e.count)
+
+		switch {
+		case e.sub != nil:
+			if len(buf)%2 == 1 {
+				buf = append(buf, 0) // IFD 偏移按字对齐
+			}
+			x.order.PutUint32(buf[p+8:], uint32(len(buf)))
+			buf = x.writeIFD(buf, e.sub)
+		case len(e.value) <= 4:
+			copy(buf[p+8:p+12], e.value)
+		default:
+			if len(buf)%2 == 1 {
+				buf = append(buf, 0) // 值偏移按字对齐
+			}
+			x.order.PutUint32(buf[p+8:], uint32(len(buf)))
+			buf = append(buf, e.value...)
+		}
+	}
+	// 下一个 IFD 偏移为0，不再链接缩略图
+	return buf
+}
+
+// orientation 返回 IFD0 中的方向标签值，缺失或无效时返回1
+func (x *exifData) orientation() int {
+	for _, e := range x.ifd0 {
+		if e.tag == exifTagOrientation && e.typ == 3 && len(e.value) >= 2 {
+			if v := int(x.order.Uint16(e.value)); v >= 1 && v <= 8 {
+				return v
+			}
+		}
+	}
+	return 1
+}
+
+// resetOrientation 像素已按方向校正后，将方向标签重置为1
+func (x *exifData) resetOrientation() {
+	for i, e := range x.ifd0 {
+		if e.tag == exifTagOrientation && e.typ == 3 && len(e.value) >= 2 {
+			x.order.PutUint16(x.ifd0[i].value, 1)
+		}
+	}
+}
+
+// filter 只保留 IFD0 中指定的标签，同时丢弃全部子 IFD
+func (x *exifData) filter(tags ...uint16) {
+	keep := make(map[uint16]bool, len(tags))
+	for _, tag := range tags {
+		keep[tag] = true
+	}
+	var entries []exifEntry
+	for _, e := range x.ifd0 {
+		if keep[e.tag] && e.sub == nil {
+			entries = append(entries, e)
+		}
+	}
+	x.ifd0 = entries
+}
+
+// EXIFOrientation 读取 EXIF 方向标签（1-8），无法解析时返回1
+func EXIFOrientation(exif []byte) int {
+	x, err := parseEXIF(exif)
+	if err != nil {
+		return 1
+	}
+	return x.orientation()
+}
@@ -0,0 +1,300 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+const (
+	exifTagMake     = 0x010f
+	exifTagModel    = 0x0110
+	exifTagDateTime = 0x9003
+	exifTagLens     = 0xa434
+	exifTagGPSLat   = 0x0002
+)
+
+// asciiEntry 生成 ASCII 类型的条目
+func asciiEntry(tag uint16, s string) exifEntry {
+	return exifEntry{tag: tag, typ: 2, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+// shortEntry 生成单个 SHORT 类型的条目
+func shortEntry(order binary.ByteOrder, tag, v uint16) exifEntry {
+	value := make([]byte, 2)
+	order.PutUint16(value, v)
+	return exifEntry{tag: tag, typ: 3, count: 1, value: value}
+}
+
+// subEntry 生成指向子 IFD 的条目，偏移在编码时写入
+func subEntry(tag uint16, sub ...exifEntry) exifEntry {
+	return exifEntry{tag: tag, typ: 4, count: 1, value: make([]byte, 4), sub: sub}
+}
+
+// buildEXIF 生成包含方向、设备、作者版权、Exif 子 IFD 和 GPS 子 IFD 的 EXIF 数据，
+// 版权和镜头型号为奇数长度，使子 IFD 之前的数据结束在奇数偏移上
+func buildEXIF(order binary.ByteOrder, orientation uint16) []byte {
+	x := &exifData{order: order, ifd0: []exifEntry{
+		asciiEntry(exifTagMake, "Canon"),
+		asciiEntry(exifTagModel, "EOS 5D Mark IV"),
+		shortEntry(order, exifTagOrientation, orientation),
+		asciiEntry(exifTagArtist, "Alice"),
+		asciiEntry(exifTagCopyright, "(c) Alice 2024"),
+		subEntry(exifTagExifIFD, asciiEntry(exifTagDateTime, "2024:01:02 03:04:05"), asciiEntry(exifTagLens, "RF50mm")),
+		subEntry(exifTagGPSIFD, asciiEntry(exifTagGPSLat, "N")),
+	}}
+	return x.encode()
+}
+
+// findEntry 在条目中查找标签
+func findEntry(entries []exifEntry, tag uint16) *exifEntry {
+	for i := range entries {
+		if entries[i].tag == tag {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func TestEXIFRoundTrip(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		data := buildEXIF(order, 6)
+		if got := EXIFOrientation(data); got != 6 {
+			t.Errorf("%v: orientation = %d, 期望 6", order, got)
+		}
+
+		x, err := parseEXIF(data)
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		if !bytes.Equal(x.encode(), data) {
+			t.Errorf("%v: 重新编码的结果与输入不一致", order)
+		}
+		gps := findEntry(x.ifd0, exifTagGPSIFD)
+		if gps == nil || findEntry(gps.sub, exifTagGPSLat) == nil {
+			t.Errorf("%v: 缺少 GPS 子 IFD", order)
+		}
+		// TIFF 要求 IFD 从字边界开始
+		for _, tag := range []uint16{exifTagExifIFD, exifTagGPSIFD} {
+			if e := findEntry(x.ifd0, tag); e == nil || order.Uint32(e.value)%2 != 0 {
+				t.Errorf("%v: 子 IFD 0x%04x 的偏移不是偶数", order, tag)
+			}
+		}
+	}
+}
+
+// keep 保留全部 EXIF，只把方向重置为1
+func TestMetadataApplyKeep(t *testing.T) {
+	m := Metadata{
+		EXIF: buildEXIF(binary.BigEndian, 6),
+		ICC:  []byte("icc"),
+		XMP:  []byte(`<rdf:Description tiff:Orientation="6"/><tiff:Orientation>8</tiff:Orientation>`),
+	}
+	out := m.Apply(MetadataKeep)
+
+	if got := EXIFOrientation(out.EXIF); got != 1 {
+		t.Errorf("EXIF orientation = %d, 期望 1", got)
+	}
+	if want := `<rdf:Description tiff:Orientation="1"/><tiff:Orientation>1</tiff:Orientation>`; string(out.XMP) != want {
+		t.Errorf("XMP = %s, 期望 %s", out.XMP, want)
+	}
+	if string(out.ICC) != "icc" {
+		t.Error("ICC 应保留")
+	}
+	x, err := parseEXIF(out.EXIF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []uint16{exifTagMake, exifTagModel, exifTagExifIFD, exifTagGPSIFD} {
+		if findEntry(x.ifd0, tag) == nil {
+			t.Errorf("keep 不应删除标签 0x%04x", tag)
+		}
+	}
+	// 输入不应被修改
+	if EXIFOrientation(m.EXIF) != 6 {
+		t.Error("Apply 修改了输入的 EXIF")
+	}
+}
+
+// keep-safe 只保留作者和版权，丢弃设备信息、GPS 等子 IFD 和 XMP
+func TestMetadataApplyKeepSafe(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		m := Metadata{EXIF: buildEXIF(order, 6), ICC: []byte("icc"), XMP: []byte("<x:xmpmeta/>")}
+		out := m.Apply(MetadataKeepSafe)
+
+		if string(out.ICC) != "icc" || out.XMP != nil {
+			t.Errorf("%v: ICC = %q, XMP = %q", order, out.ICC, out.XMP)
+		}
+		x, err := parseEXIF(out.EXIF)
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		if len(x.ifd0) != 2 {
+			t.Errorf("%v: 保留了 %d 个标签，期望只有作者和版权", order, len(x.ifd0))
+		}
+		for _, tag := range []uint16{exifTagArtist, exifTagCopyright} {
+			if findEntry(x.ifd0, tag) == nil {
+				t.Errorf("%v: 缺少标签 0x%04x", order, tag)
+			}
+		}
+		if bytes.Contains(out.EXIF, []byte("Canon")) || bytes.Contains(out.EXIF, []byte("2024:01:02")) {
+			t.Errorf("%v: 输出中仍有设备或拍摄信息", order)
+		}
+	}
+
+	// 没有作者和版权时不输出 EXIF
+	x := &exifData{order: binary.LittleEndian, ifd0: []exifEntry{
+		asciiEntry(exifTagMake, "Canon"),
+		subEntry(exifTagGPSIFD, asciiEntry(exifTagGPSLat, "N")),
+	}}
+	if out := (Metadata{EXIF: x.encode()}).Apply(MetadataKeepSafe); out.EXIF != nil {
+		t.Errorf("EXIF = %x, 期望为空", out.EXIF)
+	}
+}
+
+func TestMetadataApplyStrip(t *testing.T) {
+	m := Metadata{EXIF: buildEXIF(binary.LittleEndian, 1), ICC: []byte("icc"), XMP: []byte("<x:xmpmeta/>")}
+	if out := m.Apply(MetadataStrip); !out.Empty() {
+		t.Errorf("strip 后仍有元数据: %+v", out)
+	}
+}
+
+// tiffHeader 小端序 TIFF 文件头，IFD0 位于 offset
+func tiffHeader(offset uint32) []byte {
+	return binary.LittleEndian.AppendUint32([]byte("II*\x00"), offset)
+}
+
+// ifd 生成小端序的 IFD，每个条目为 tag、type、count、value/offset
+func ifd(entries ...[4]uint32) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, uint16(len(entries)))
+	for _, e := range entries {
+		b = binary.LittleEndian.AppendUint16(b, uint16(e[0]))
+		b = binary.LittleEndian.AppendUint16(b, uint16(e[1]))
+		b = binary.LittleEndian.AppendUint32(b, e[2])
+		b = binary.LittleEndian.AppendUint32(b, e[3])
+	}
+	return binary.LittleEndian.AppendUint32(b, 0)
+}
+
+func TestParseEXIFMalformed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":           nil,
+		"short":           []byte("II*\x00"),
+		"bad-byte-order":  append([]byte("XX*\x00"), 8, 0, 0, 0),
+		"bad-magic":       append([]byte("II+\x00"), 8, 0, 0, 0),
+		"ifd-out-of-file": tiffHeader(100),
+		"truncated-ifd":   append(tiffHeader(8), 5, 0, 1, 2),
+		"too-many-items":  append(tiffHeader(8), 0xff, 0xff),
+	} {
+		if _, err := parseEXIF(data); err == nil {
+			t.Errorf("%s: 期望解析失败", name)
+		}
+		if got := EXIFOrientation(data); got != 1 {
+			t.Errorf("%s: orientation = %d, 期望 1", name, got)
+		}
+		if out := (Metadata{EXIF: data}).Apply(MetadataKeep); out.EXIF != nil {
+			t.Errorf("%s: 无法解析的 EXIF 不应输出", name)
+		}
+	}
+}
+
+// 值偏移越界、未知类型和无效的子 IFD 条目被丢弃，其余条目保留
+func TestParseEXIFInvalidEntries(t *testing.T) {
+	data := append(tiffHeader(8), ifd(
+		[4]uint32{exifTagOrientation, 3, 1, 8},
+		[4]uint32{exifTagMake, 2, 100, 1000},       // 值偏移越界
+		[4]uint32{exifTagModel, 99, 1, 0},          // 未知类型
+		[4]uint32{exifTagGPSIFD, 4, 1, 1000},       // 子 IFD 越界
+		[4]uint32{exifTagExifIFD, 4, 2, 0},         // 子 IFD 条目的 count 无效
+		[4]uint32{exifTagArtist, 2, 0xffffffff, 8}, // 长度溢出
+	)...)
+	x, err := parseEXIF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(x.ifd0) != 1 || x.orientation() != 8 {
+		t.Errorf("解析结果 %+v, 期望只保留方向标签", x.ifd0)
+	}
+}
+
+// 子 IFD 指向自身或祖先时按深度上限截断，不会无限递归
+func TestParseEXIFCyclicIFD(t *testing.T) {
+	for name, data := range map[string][]byte{
+		// IFD0 的 Exif 子 IFD 指向 IFD0 自身
+		"self": append(tiffHeader(8), ifd(
+			[4]uint32{exifTagOrientation, 3, 1, 6},
+			[4]uint32{exifTagExifIFD, 4, 1, 8},
+		)...),
+		// IFD0 -> GPS（偏移38）-> Interop 指回 IFD0
+		"loop": append(append(tiffHeader(8), ifd(
+			[4]uint32{exifTagOrientation, 3, 1, 6},
+			[4]uint32{exifTagGPSIFD, 4, 1, 38},
+		)...), ifd(
+			[4]uint32{exifTagInteropIFD, 4, 1, 8},
+		)...),
+	} {
+		x, err := parseEXIF(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		depth := 0
+		for entries := x.ifd0; entries != nil; depth++ {
+			var next []exifEntry
+			for _, e := range entries {
+				if e.sub != nil {
+					next = e.sub
+				}
+			}
+			entries = next
+		}
+		if depth < 2 || depth > exifMaxDepth+1 {
+			t.Errorf("%s: 子 IFD 嵌套 %d 层，期望在 2-%d 之间", name, depth, exifMaxDepth+1)
+		}
+
+		out := (Metadata{EXIF: data}).Apply(MetadataKeep)
+		if got := EXIFOrientation(out.EXIF); got != 1 {
+			t.Errorf("%s: orientation = %d, 期望 1", name, got)
+		}
+		if len(out.EXIF) > 4096 {
+			t.Errorf("%s: 输出 %d 字节，环状结构未被截断", name, len(out.EXIF))
+		}
+		if out := (Metadata{EXIF: data}).Apply(MetadataKeepSafe); out.EXIF != nil {
+			t.Errorf("%s: keep-safe 不应保留任何标签", name)
+		}
+	}
+}
+
+// 带方向标签的 JPEG 解码时按方向旋转像素，keep 输出的方向为1，再次解码尺寸不变
+func TestDecodeJPEGOrientation(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	var buf bytes.Buffer
+	err := Encode(&buf, "jpeg", src, Options{
+		MetadataPolicy: MetadataKeep,
+		Metadata:       Metadata{EXIF: buildEXIF(binary.LittleEndian, 6)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, format, meta, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || img.Bounds().Dx() != 2 || img.Bounds().Dy() != 4 {
+		t.Fatalf("format = %s, 尺寸 = %v, 期望旋转为 2×4", format, img.Bounds().Size())
+	}
+
+	buf.Reset()
+	err = Encode(&buf, "jpeg", img, Options{MetadataPolicy: MetadataKeep, Metadata: meta.Apply(MetadataKeep)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _, meta, err = Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if EXIFOrientation(meta.EXIF) != 1 || img.Bounds().Dx() != 2 || img.Bounds().Dy() != 4 {
+		t.Errorf("orientation = %d, 尺寸 = %v, 期望 1 和 2×4", EXIFOrientation(meta.EXIF), img.Bounds().Size())
+	}
+}
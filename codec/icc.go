@@ -0,0 +1,322 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// ICCMode 带 ICC 配置文件的图片的输出方式
+type ICCMode string
+
+const (
+	ICCEmbed ICCMode = "embed" // 像素保持原配置文件的色彩空间，输出时重新嵌入原配置文件
+	ICCSRGB  ICCMode = "srgb"  // 解码后转换到 sRGB，输出不携带配置文件
+	ICCNone  ICCMode = "none"  // 输入没有配置文件，或配置文件无法转换且输出格式无法嵌入
+)
+
+// ParseICCMode 解析 ICC 输出方式，为空时由元数据策略决定
+func ParseICCMode(s string) (ICCMode, error) {
+	switch mode := ICCMode(strings.ToLower(s)); mode {
+	case "", ICCEmbed, ICCSRGB:
+		return mode, nil
+	}
+	return "", errors.New("iccMode 参数仅支持 embed 或 srgb")
+}
+
+// ResolveICCMode 决定带配置文件的输入实际采用的输出方式：
+// 未指定时，元数据策略保留 ICC 则嵌入，否则转换到 sRGB；
+// BMP、TIFF 无法嵌入配置文件，只能转换；无法解析的配置文件只能原样嵌入
+func ResolveICCMode(requested ICCMode, profile []byte, format string, policy MetadataPolicy) ICCMode {
+	if len(profile) == 0 {
+		return ICCNone
+	}
+	embeddable := EffectivePolicy(format, MetadataKeep) != MetadataStrip
+
+	mode := requested
+	if mode == "" {
+		mode = ICCSRGB
+		if EffectivePolicy(format, policy) != MetadataStrip {
+			mode = ICCEmbed
+		}
+	}
+	if mode == ICCEmbed && !embeddable {
+		mode = ICCSRGB
+	}
+	if mode == ICCSRGB {
+		if _, err := ParseICC(profile); err != nil {
+			if embeddable {
+				return ICCEmbed
+			}
+			return ICCNone
+		}
+	}
+	return mode
+}
+
+var errUnsupportedICC = errors.New("icc: 仅支持 RGB 矩阵/TRC 配置文件")
+
+// srgbD50 sRGB 三原色在 D50 PCS 下的 XYZ 值（按列排列），与标准 sRGB 配置文件一致
+var srgbD50 = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// ICCProfile 解析后的矩阵/TRC 型 RGB 配置文件，如 Display P3、Adobe RGB
+type ICCProfile struct {
+	matrix [3][3]float64 // 线性 RGB -> D50 XYZ
+	curves [3]iccCurve   // 各通道的色调响应曲线
+}
+
+// iccCurve 色调响应曲线，将编码值 [0,1] 映射为线性值 [0,1]
+type iccCurve struct {
+	table  []float64  // 采样表，为空时使用参数函数
+	kind   int        // 参数函数类型 0-4
+	params [7]float64 // g, a, b, c, d, e, f
+}
+
+// ParseICC 解析 ICC 配置文件，只支持以 XYZ 为 PCS 的 RGB 矩阵/TRC 配置文件
+// 基于查找表（A2B0）的配置文件、灰度和 CMYK 配置文件返回错误
+func ParseICC(data []byte) (*ICCProfile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, errors.New("icc: 数据格式无效")
+	}
+	if string(data[16:20]) != "RGB " || string(data[20:24]) != "XYZ " {
+		return nil, errUnsupportedICC
+	}
+
+	tags := make(map[string][]byte)
+	n := binary.BigEndian.Uint32(data[128:])
+	if uint64(n)*12+132 > uint64(len(data)) {
+		return nil, errors.New("icc: 数据格式无效")
+	}
+	for i := uint32(0); i < n; i++ {
+		p := data[132+12*i:]
+		offset, size := binary.BigEndian.Uint32(p[4:]), binary.BigEndian.Uint32(p[8:])
+		if uint64(offset)+uint64(size) > uint64(len(data)) {
+			continue
+		}
+		tags[string(p[:4])] = data[offset : offset+size]
+	}
+
+	p := &ICCProfile{}
+	for i, sig := range [3]string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, ok := parseICCXYZ(tags[sig])
+		if !ok {
+			return nil, errUnsupportedICC
+		}
+		for row := 0; row < 3; row++ {
+			p.matrix[row][i] = xyz[row]
+		}
+	}
+	for i, sig := range [3]string{"rTRC", "gTRC", "bTRC"} {
+		curve, ok := parseICCCurve(tags[sig])
+		if !ok || !curve.finite() {
+			return nil, errUnsupportedICC
+		}
+		p.curves[i] = curve
+	}
+	return p, nil
+}
+
+func iccS15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func parseICCXYZ(b []byte) ([3]float64, bool) {
+	if len(b) < 20 || string(b[:4]) != "XYZ " {
+		return [3]float64{}, false
+	}
+	return [3]float64{iccS15Fixed16(b[8:]), iccS15Fixed16(b[12:]), iccS15Fixed16(b[16:])}, true
+}
+
+// iccParaCounts 各参数函数类型的参数个数
+var iccParaCounts = [5]int{1, 3, 4, 5, 7}
+
+func parseICCCurve(b []byte) (iccCurve, bool) {
+	if len(b) < 12 {
+		return iccCurve{}, false
+	}
+	switch string(b[:4]) {
+	case "curv":
+		n := binary.BigEndian.Uint32(b[8:])
+		switch {
+		case n == 0:
+			return iccCurve{params: [7]float64{1}}, true
+		case n == 1 && len(b) >= 14:
+			return iccCurve{params: [7]float64{float64(binary.BigEndian.Uint16(b[12:])) / 256}}, true
+		case uint64(n)*2+12 <= uint64(len(b)):
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(b[12+2*i:])) / 65535
+			}
+			return iccCurve{table: table}, true
+		}
+	case "para":
+		kind := int(binary.BigEndian.Uint16(b[8:]))
+		if kind >= len(iccParaCounts) || len(b) < 12+4*iccParaCounts[kind] {
+			return iccCurve{}, false
+		}
+		curve := iccCurve{kind: kind}
+		for i := 0; i < iccParaCounts[kind]; i++ {
+			curve.params[i] = iccS15Fixed16(b[12+4*i:])
+		}
+		return curve, true
+	}
+	return iccCurve{}, false
+}
+
+// eval 计算编码值 x 对应的线性值
+func (c iccCurve) eval(x float64) float64 {
+	if c.table != nil {
+		if len(c.table) == 1 {
+			return c.table[0]
+		}
+		pos := x * float64(len(c.table)-1)
+		i := min(int(pos), len(c.table)-2)
+		frac := pos - float64(i)
+		return c.table[i]*(1-frac) + c.table[i+1]*frac
+	}
+
+	g, a, b, cc, d, e, f := c.params[0], c.params[1], c.params[2], c.params[3], c.params[4], c.params[5], c.params[6]
+	switch c.kind {
+	case 1:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g)
+		}
+		return 0
+	case 2:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g) + cc
+		}
+		return cc
+	case 3:
+		if x >= d {
+			return math.Pow(a*x+b, g)
+		}
+		return cc * x
+	case 4:
+		if x >= d {
+			return math.Pow(a*x+b, g) + e
+		}
+		return cc*x + f
+	}
+	return math.Pow(x, g)
+}
+
+// finite 曲线在全部8位编码值上是否都得到有限值；参数不合法（如底数为负、指数为小数）时会得到 NaN
+func (c iccCurve) finite() bool {
+	for v := 0; v < 256; v++ {
+		y := c.eval(float64(v) / 255)
+		if math.IsNaN(y) || math.IsInf(y, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// srgbEncode 线性值转换为 sRGB 编码值
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// srgbEncodeSteps 线性值到 sRGB 8位编码值查找表的精度
+const srgbEncodeSteps = 1 << 14
+
+// toSRGBTransform 返回由配置文件线性 RGB 到线性 sRGB 的矩阵
+func (p *ICCProfile) toSRGBTransform() [3][3]float64 {
+	return mul3(inv3(srgbD50), p.matrix)
+}
+
+// IsSRGB 配置文件是否与 sRGB 等效（差异不超过8位量化误差），等效时无需转换
+func (p *ICCProfile) IsSRGB() bool {
+	t := p.toSRGBTransform()
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(t[i][j]-want) > 0.002 {
+				return false
+			}
+		}
+	}
+	for _, c := range p.curves {
+		for v := 0; v < 256; v++ {
+			if math.Abs(srgbEncode(c.eval(float64(v)/255))*255-float64(v)) > 0.5 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ToSRGB 将按该配置文件编码的图片转换为 sRGB，超出 sRGB 色域的颜色被裁剪，透明度不变
+func (p *ICCProfile) ToSRGB(img image.Image) image.Image {
+	if p.IsSRGB() {
+		return img
+	}
+
+	var decode [3][256]float64
+	for c := 0; c < 3; c++ {
+		for v := 0; v < 256; v++ {
+			decode[c][v] = p.curves[c].eval(float64(v) / 255)
+		}
+	}
+	var encode [srgbEncodeSteps + 1]uint8
+	for i := range encode {
+		encode[i] = uint8(math.Round(srgbEncode(float64(i)/srgbEncodeSteps) * 255))
+	}
+	t := p.toSRGBTransform()
+
+	dst := imaging.Clone(img)
+	for i := 0; i+3 < len(dst.Pix); i += 4 {
+		r, g, b := decode[0][dst.Pix[i]], decode[1][dst.Pix[i+1]], decode[2][dst.Pix[i+2]]
+		for c := 0; c < 3; c++ {
+			v := t[c][0]*r + t[c][1]*g + t[c][2]*b
+			if !(v > 0) { // 同时排除 NaN
+				v = 0
+			}
+			dst.Pix[i+c] = encode[int(math.Min(1, v)*srgbEncodeSteps+0.5)]
+		}
+	}
+	return dst
+}
+
+func mul3(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func inv3(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	var r [3][3]float64
+	r[0][0] = (m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det
+	r[0][1] = (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det
+	r[0][2] = (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det
+	r[1][0] = (m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det
+	r[1][1] = (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det
+	r[1][2] = (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det
+	r[2][0] = (m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det
+	r[2][1] = (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det
+	r[2][2] = (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det
+	return r
+}
@@ -0,0 +1,121 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// buildICC 构造矩阵/TRC 型 RGB 配置文件，三原色使用 sRGB 的值，三个通道共用同一条曲线
+func buildICC(curve []byte) []byte {
+	xyz := func(x, y, z float64) []byte {
+		b := append([]byte("XYZ "), 0, 0, 0, 0)
+		for _, v := range []float64{x, y, z} {
+			b = binary.BigEndian.AppendUint32(b, uint32(int32(v*65536)))
+		}
+		return b
+	}
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"rXYZ", xyz(srgbD50[0][0], srgbD50[1][0], srgbD50[2][0])},
+		{"gXYZ", xyz(srgbD50[0][1], srgbD50[1][1], srgbD50[2][1])},
+		{"bXYZ", xyz(srgbD50[0][2], srgbD50[1][2], srgbD50[2][2])},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	header := make([]byte, 128)
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	copy(header[36:], "acsp")
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	offset := 128 + 4 + 12*len(tags)
+	var body []byte
+	for _, tag := range tags {
+		table = append(table, tag.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset+len(body)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag.data)))
+		body = append(body, tag.data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	profile := append(append(header, table...), body...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+// paraCurve 构造 para 类型曲线
+func paraCurve(kind uint16, params ...float64) []byte {
+	b := append([]byte("para"), 0, 0, 0, 0)
+	b = binary.BigEndian.AppendUint16(b, kind)
+	b = append(b, 0, 0)
+	for _, v := range params {
+		b = binary.BigEndian.AppendUint32(b, uint32(int32(v*65536)))
+	}
+	return b
+}
+
+func TestParseICCRejectsNaNCurve(t *testing.T) {
+	// 类型3: x ≥ d 时为 (a·x+b)^g；b<0 且 g 为小数时在 x 较小处得到 NaN
+	bad := buildICC(paraCurve(3, 2.2, 1, -0.5, 1, 0))
+	if _, err := ParseICC(bad); err == nil {
+		t.Fatal("包含 NaN 曲线的配置文件应被拒绝")
+	}
+	if mode := ResolveICCMode(ICCSRGB, bad, "png", MetadataStrip); mode != ICCEmbed {
+		t.Errorf("PNG 输出应回退为原样嵌入，实际为 %s", mode)
+	}
+	if mode := ResolveICCMode(ICCSRGB, bad, "bmp", MetadataStrip); mode != ICCNone {
+		t.Errorf("BMP 输出无法嵌入，应为 none，实际为 %s", mode)
+	}
+}
+
+func TestParseICCGamma(t *testing.T) {
+	p, err := ParseICC(buildICC(paraCurve(0, 1.8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IsSRGB() {
+		t.Error("gamma 1.8 不应视为 sRGB")
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	img.SetNRGBA(1, 0, color.NRGBA{255, 255, 255, 255})
+	out := p.ToSRGB(img).(*image.NRGBA)
+	if !bytes.Equal(out.Pix, img.Pix) {
+		t.Errorf("黑白两端转换后应保持不变: %v", out.Pix)
+	}
+
+	if p, err := ParseICC(buildICC(paraCurve(3, 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045))); err != nil || !p.IsSRGB() {
+		t.Errorf("sRGB 参数曲线应识别为 sRGB: %v", err)
+	}
+}
+
+// 带非法 iCCP 的 PNG 在请求转换到 sRGB 时不能崩溃
+func TestDecodePNGWithNaNProfile(t *testing.T) {
+	profile := buildICC(paraCurve(3, 2.2, 1, -0.5, 1, 0))
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	var buf bytes.Buffer
+	err := Encode(&buf, "png", img, Options{MetadataPolicy: MetadataKeep, Metadata: Metadata{ICC: profile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, meta, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(meta.ICC, profile) {
+		t.Fatal("解码后未读到 iCCP 配置文件")
+	}
+	if _, err := ParseICC(meta.ICC); err == nil {
+		t.Fatal("包含 NaN 曲线的配置文件应被拒绝")
+	}
+}
@@ -0,0 +1,563 @@
+package codec
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+// 标准库 image/jpeg 只能输出基线(baseline) 4:2:0 编码，
+// 这里实现一个支持渐进式(progressive)和 4:4:4 / 4:2:2 色度采样的编码器。
+// 渐进式编码只使用频谱选择(spectral selection)，不做逐次逼近，
+// 因此可以直接沿用 JPEG 标准附录K中的哈夫曼表。
+
+// ChromaSubsampling JPEG 色度采样方式
+type ChromaSubsampling int
+
+const (
+	Subsampling420 ChromaSubsampling = iota // 默认，与标准库一致
+	Subsampling422
+	Subsampling444
+)
+
+// ParseSubsampling 解析色度采样参数，如 "420"、"4:2:2"
+func ParseSubsampling(s string) (ChromaSubsampling, error) {
+	switch s {
+	case "", "420", "4:2:0":
+		return Subsampling420, nil
+	case "422", "4:2:2":
+		return Subsampling422, nil
+	case "444", "4:4:4":
+		return Subsampling444, nil
+	}
+	return 0, errors.New("色度采样仅支持 420、422、444")
+}
+
+// factors 亮度分量的水平、垂直采样因子
+func (s ChromaSubsampling) factors() (h, v int) {
+	switch s {
+	case Subsampling422:
+		return 2, 1
+	case Subsampling444:
+		return 1, 1
+	}
+	return 2, 2
+}
+
+// JPEGOptions JPEG 编码参数
+type JPEGOptions struct {
+	Quality     int // 1-100
+	Progressive bool
+	Subsampling ChromaSubsampling
+}
+
+// EncodeJPEG 编码JPEG；基线 4:2:0 直接使用标准库，其余情况使用内置编码器
+func EncodeJPEG(w io.Writer, img image.Image, opts JPEGOptions) error {
+	if opts.Quality < 1 {
+		opts.Quality = 1
+	} else if opts.Quality > 100 {
+		opts.Quality = 100
+	}
+
+	if !opts.Progressive && opts.Subsampling == Subsampling420 {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: opts.Quality})
+	}
+
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 || b.Dx() >= 1<<16 || b.Dy() >= 1<<16 {
+		return errors.New("jpeg: 图片尺寸无效")
+	}
+
+	e := &jpegEncoder{w: bufio.NewWriter(w)}
+	e.encode(img, opts)
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// zigzag 之字形扫描顺序到自然顺序的映射
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// 标准量化表（之字形顺序）
+var unscaledQuant = [2][64]int{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// huffmanSpec 哈夫曼表定义：各码长的码字数量及对应符号
+type huffmanSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+// 标准哈夫曼表：亮度DC、亮度AC、色度DC、色度AC
+var huffmanSpecs = [4]huffmanSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// huffmanCode 单个符号的码字
+type huffmanCode struct {
+	code uint32
+	size uint8
+}
+
+// huffmanTables 由 huffmanSpecs 生成的编码查找表
+var huffmanTables = func() [4][256]huffmanCode {
+	var tables [4][256]huffmanCode
+	for i, spec := range huffmanSpecs {
+		code, k := uint32(0), 0
+		for length := 1; length <= 16; length++ {
+			for n := 0; n < int(spec.counts[length-1]); n++ {
+				tables[i][spec.values[k]] = huffmanCode{code: code, size: uint8(length)}
+				code++
+				k++
+			}
+			code <<= 1
+		}
+	}
+	return tables
+}()
+
+// dctCos 预计算的DCT余弦表 cos((2x+1)uπ/16)
+var dctCos = func() [8][8]float64 {
+	var t [8][8]float64
+	for u := 0; u < 8; u++ {
+		for x := 0; x < 8; x++ {
+			t[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / 16)
+		}
+	}
+	return t
+}()
+
+// jpegComponent 颜色分量及其量化后的系数块
+type jpegComponent struct {
+	id      byte
+	h, v    int // 采样因子
+	table   int // 0 亮度，1 色度
+	blocksW int // 按MCU对齐后的块列数
+	blocksH int
+	scanW   int // 非交错扫描时实际编码的块列数
+	scanH   int
+	blocks  [][64]int16 // 之字形顺序的量化系数
+}
+
+type jpegEncoder struct {
+	w     *bufio.Writer
+	err   error
+	bits  uint32
+	nBits uint
+	quant [2][64]int // 之字形顺序
+}
+
+func (e *jpegEncoder) write(p []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(p)
+	}
+}
+
+func (e *jpegEncoder) writeByte(b byte) {
+	if e.err == nil {
+		e.err = e.w.WriteByte(b)
+	}
+}
+
+// writeMarker 写入标记段，length 不含标记本身
+func (e *jpegEncoder) writeMarker(marker byte, payload []byte) {
+	e.write([]byte{0xff, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)})
+	e.write(payload)
+}
+
+// emit 写入 size 位，处理 0xFF 字节填充
+func (e *jpegEncoder) emit(bits uint32, size uint) {
+	if size == 0 {
+		return
+	}
+	bits &= (1 << size) - 1
+	e.bits = e.bits<<size | bits
+	e.nBits += size
+	for e.nBits >= 8 {
+		b := byte(e.bits >> (e.nBits - 8))
+		e.writeByte(b)
+		if b == 0xff {
+			e.writeByte(0x00)
+		}
+		e.nBits -= 8
+	}
+}
+
+// flushBits 用1填充剩余位
+func (e *jpegEncoder) flushBits() {
+	if e.nBits > 0 {
+		e.emit(0x7f, 8-e.nBits)
+	}
+	e.bits, e.nBits = 0, 0
+}
+
+func (e *jpegEncoder) emitHuff(table int, symbol byte) {
+	c := huffmanTables[table][symbol]
+	e.emit(c.code, uint(c.size))
+}
+
+// magnitude 返回数值的位数类别及其编码位
+func magnitude(v int) (size uint, bits uint32) {
+	a := v
+	if a < 0 {
+		a = -a
+		v--
+	}
+	for a > 0 {
+		size++
+		a >>= 1
+	}
+	return size, uint32(v)
+}
+
+func (e *jpegEncoder) encode(img image.Image, opts JPEGOptions) {
+	// 按质量缩放量化表（IJG公式）
+	scale := 200 - 2*opts.Quality
+	if opts.Quality < 50 {
+		scale = 5000 / opts.Quality
+	}
+	for t := 0; t < 2; t++ {
+		for k := 0; k < 64; k++ {
+			q := (unscaledQuant[t][k]*scale + 50) / 100
+			if q < 1 {
+				q = 1
+			} else if q > 255 {
+				q = 255
+			}
+			e.quant[t][k] = q
+		}
+	}
+
+	comps := e.buildComponents(img, opts.Subsampling)
+	b := img.Bounds()
+
+	// SOI 与 JFIF APP0
+	e.write([]byte{0xff, 0xd8})
+	e.writeMarker(0xe0, []byte{'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0})
+
+	// DQT
+	dqt := make([]byte, 0, 2*65)
+	for t := 0; t < 2; t++ {
+		dqt = append(dqt, byte(t))
+		for k := 0; k < 64; k++ {
+			dqt = append(dqt, byte(e.quant[t][k]))
+		}
+	}
+	e.writeMarker(0xdb, dqt)
+
+	// SOF0 基线 / SOF2 渐进式
+	sof := []byte{8, byte(b.Dy() >> 8), byte(b.Dy()), byte(b.Dx() >> 8), byte(b.Dx()), byte(len(comps))}
+	for _, c := range comps {
+		sof = append(sof, c.id, byte(c.h<<4|c.v), byte(c.table))
+	}
+	if opts.Progressive {
+		e.writeMarker(0xc2, sof)
+	} else {
+		e.writeMarker(0xc0, sof)
+	}
+
+	// DHT
+	dht := make([]byte, 0, 420)
+	for i, spec := range huffmanSpecs {
+		class, id := byte(i%2), byte(i/2)
+		dht = append(dht, class<<4|id)
+		dht = append(dht, spec.counts[:]...)
+		dht = append(dht, spec.values...)
+	}
+	e.writeMarker(0xc4, dht)
+
+	if opts.Progressive {
+		// DC 交错扫描，之后每个分量两次 AC 频谱选择扫描
+		e.writeScan(comps, 0, 0)
+		for i := range comps {
+			e.writeScan(comps[i:i+1], 1, 5)
+			e.writeScan(comps[i:i+1], 6, 63)
+		}
+	} else {
+		e.writeScan(comps, 0, 63)
+	}
+
+	// EOI
+	e.write([]byte{0xff, 0xd9})
+}
+
+// buildComponents 颜色转换、色度下采样并计算全部量化系数
+func (e *jpegEncoder) buildComponents(img image.Image, sub ChromaSubsampling) []*jpegComponent {
+	b := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	}
+	w, h := b.Dx(), b.Dy()
+
+	hMax, vMax := sub.factors()
+	mcuW, mcuH := 8*hMax, 8*vMax
+	paddedW := (w + mcuW - 1) / mcuW * mcuW
+	paddedH := (h + mcuH - 1) / mcuH * mcuH
+
+	// 全分辨率 YCbCr 平面，超出部分复制边缘像素
+	planes := [3][]float64{
+		make([]float64, paddedW*paddedH),
+		make([]float64, paddedW*paddedH),
+		make([]float64, paddedW*paddedH),
+	}
+	for y := 0; y < paddedH; y++ {
+		sy := y
+		if sy >= h {
+			sy = h - 1
+		}
+		for x := 0; x < paddedW; x++ {
+			sx := x
+			if sx >= w {
+				sx = w - 1
+			}
+			off := rgba.PixOffset(rgba.Rect.Min.X+sx, rgba.Rect.Min.Y+sy)
+			yy, cb, cr := color.RGBToYCbCr(rgba.Pix[off], rgba.Pix[off+1], rgba.Pix[off+2])
+			i := y*paddedW + x
+			planes[0][i] = float64(yy)
+			planes[1][i] = float64(cb)
+			planes[2][i] = float64(cr)
+		}
+	}
+
+	comps := []*jpegComponent{
+		{id: 1, h: hMax, v: vMax, table: 0},
+		{id: 2, h: 1, v: 1, table: 1},
+		{id: 3, h: 1, v: 1, table: 1},
+	}
+	for i, c := range comps {
+		// 分量相对于最大采样因子的缩小倍数
+		fx, fy := hMax/c.h, vMax/c.v
+		cw, ch := paddedW/fx, paddedH/fy
+		c.blocksW, c.blocksH = cw/8, ch/8
+		c.scanW = ((w*c.h+hMax-1)/hMax + 7) / 8
+		c.scanH = ((h*c.v+vMax-1)/vMax + 7) / 8
+		c.blocks = make([][64]int16, c.blocksW*c.blocksH)
+
+		plane := planes[i]
+		var block [64]float64
+		for by := 0; by < c.blocksH; by++ {
+			for bx := 0; bx < c.blocksW; bx++ {
+				for y := 0; y < 8; y++ {
+					for x := 0; x < 8; x++ {
+						// 下采样时取 fx*fy 区域的平均值
+						sum := 0.0
+						px, py := (bx*8+x)*fx, (by*8+y)*fy
+						for dy := 0; dy < fy; dy++ {
+							for dx := 0; dx < fx; dx++ {
+								sum += plane[(py+dy)*paddedW+px+dx]
+							}
+						}
+						block[y*8+x] = sum/float64(fx*fy) - 128
+					}
+				}
+				e.fdctQuantize(&block, c.table, &c.blocks[by*c.blocksW+bx])
+			}
+		}
+	}
+	return comps
+}
+
+// fdctQuantize 二维DCT并量化，输出之字形顺序系数
+func (e *jpegEncoder) fdctQuantize(block *[64]float64, table int, out *[64]int16) {
+	var tmp, natural [64]float64
+	// 行变换
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			sum := 0.0
+			for x := 0; x < 8; x++ {
+				sum += block[y*8+x] * dctCos[u][x]
+			}
+			tmp[y*8+u] = sum
+		}
+	}
+	// 列变换并量化
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			sum := 0.0
+			for y := 0; y < 8; y++ {
+				sum += tmp[y*8+u] * dctCos[v][y]
+			}
+			cu, cv := 1.0, 1.0
+			if u == 0 {
+				cu = math.Sqrt2 / 2
+			}
+			if v == 0 {
+				cv = math.Sqrt2 / 2
+			}
+			natural[v*8+u] = sum * cu * cv / 4
+		}
+	}
+	for k := 0; k < 64; k++ {
+		out[k] = int16(math.Round(natural[zigzag[k]] / float64(e.quant[table][k])))
+	}
+}
+
+// writeScan 写入一次扫描，ss/se 为频谱选择范围
+func (e *jpegEncoder) writeScan(comps []*jpegComponent, ss, se int) {
+	sos := []byte{byte(len(comps))}
+	for _, c := range comps {
+		sos = append(sos, c.id, byte(c.table<<4|c.table))
+	}
+	sos = append(sos, byte(ss), byte(se), 0)
+	e.writeMarker(0xda, sos)
+
+	preds := make([]int, len(comps))
+	if len(comps) == 1 {
+		// 非交错扫描按分量自身的块栅格顺序编码
+		c := comps[0]
+		for by := 0; by < c.scanH; by++ {
+			for bx := 0; bx < c.scanW; bx++ {
+				e.encodeBlock(&c.blocks[by*c.blocksW+bx], c.table, &preds[0], ss, se)
+			}
+		}
+	} else {
+		// 交错扫描按MCU顺序编码
+		mcusX, mcusY := comps[0].blocksW/comps[0].h, comps[0].blocksH/comps[0].v
+		for my := 0; my < mcusY; my++ {
+			for mx := 0; mx < mcusX; mx++ {
+				for i, c := range comps {
+					for v := 0; v < c.v; v++ {
+						for h := 0; h < c.h; h++ {
+							idx := (my*c.v+v)*c.blocksW + mx*c.h + h
+							e.encodeBlock(&c.blocks[idx], c.table, &preds[i], ss, se)
+						}
+					}
+				}
+			}
+		}
+	}
+	e.flushBits()
+}
+
+// encodeBlock 编码单个块中 ss..se 范围内的系数
+func (e *jpegEncoder) encodeBlock(block *[64]int16, table int, pred *int, ss, se int) {
+	dcTable, acTable := table*2, table*2+1
+
+	if ss == 0 {
+		diff := int(block[0]) - *pred
+		*pred = int(block[0])
+		size, bits := magnitude(diff)
+		e.emitHuff(dcTable, byte(size))
+		e.emit(bits, size)
+		ss = 1
+	}
+	if se == 0 {
+		return
+	}
+
+	run := 0
+	for k := ss; k <= se; k++ {
+		coef := int(block[k])
+		if coef == 0 {
+			run++
+			continue
+		}
+		for run > 15 {
+			e.emitHuff(acTable, 0xf0) // ZRL
+			run -= 16
+		}
+		size, bits := magnitude(coef)
+		e.emitHuff(acTable, byte(run<<4)|byte(size))
+		e.emit(bits, size)
+		run = 0
+	}
+	if run > 0 {
+		e.emitHuff(acTable, 0x00) // EOB
+	}
+}
@@ -0,0 +1,140 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+// testPattern 生成带平缓渐变和一条色彩边缘的测试图片，alpha 为 true 时透明度随位置变化
+func testPattern(w, h int, alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{uint8(x * 3), uint8(y * 3), 128, 255}
+			if x > w/2 {
+				c.B = 32
+			}
+			if alpha {
+				c.A = uint8(255 - (x+y)*8%256)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// meanAbsDiff 返回 a、b 在 RGB 上的平均绝对差，b 的坐标从 b.Bounds().Min 开始对齐
+func meanAbsDiff(a *image.RGBA, b image.Image) float64 {
+	var sum float64
+	w, h := a.Bounds().Dx(), a.Bounds().Dy()
+	min := b.Bounds().Min
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, bl, _ := b.At(min.X+x, min.Y+y).RGBA()
+			p := a.RGBAAt(x, y)
+			sum += math.Abs(float64(p.R)-float64(r>>8)) + math.Abs(float64(p.G)-float64(g>>8)) + math.Abs(float64(p.B)-float64(bl>>8))
+		}
+	}
+	return sum / float64(3*w*h)
+}
+
+// 内置编码器的输出可被标准库解码，尺寸、采样方式和画面与输入一致
+func TestEncodeJPEGRoundTrip(t *testing.T) {
+	subsamplings := map[ChromaSubsampling]image.YCbCrSubsampleRatio{
+		Subsampling420: image.YCbCrSubsampleRatio420,
+		Subsampling422: image.YCbCrSubsampleRatio422,
+		Subsampling444: image.YCbCrSubsampleRatio444,
+	}
+	sizes := [][2]int{{1, 1}, {7, 5}, {17, 9}, {33, 31}, {64, 48}}
+
+	for _, progressive := range []bool{false, true} {
+		for sub, ratio := range subsamplings {
+			for _, size := range sizes {
+				for _, alpha := range []bool{false, true} {
+					name := fmt.Sprintf("progressive=%v/sub=%d/%dx%d/alpha=%v", progressive, sub, size[0], size[1], alpha)
+					t.Run(name, func(t *testing.T) {
+						src := testPattern(size[0], size[1], alpha)
+						var buf bytes.Buffer
+						if err := EncodeJPEG(&buf, src, JPEGOptions{Quality: 95, Progressive: progressive, Subsampling: sub}); err != nil {
+							t.Fatal(err)
+						}
+						decoded, err := jpeg.Decode(&buf)
+						if err != nil {
+							t.Fatalf("标准库无法解码: %v", err)
+						}
+						if got := decoded.Bounds().Size(); got != src.Bounds().Size() {
+							t.Fatalf("尺寸 = %v, 期望 %v", got, src.Bounds().Size())
+						}
+						if ycc, ok := decoded.(*image.YCbCr); !ok || ycc.SubsampleRatio != ratio {
+							t.Errorf("解码结果 %T 的采样方式与 %d 不一致", decoded, sub)
+						}
+
+						// JPEG 不支持透明度，期望结果为按 alpha 预乘后的颜色
+						want := image.NewRGBA(src.Bounds())
+						draw.Draw(want, want.Bounds(), src, image.Point{}, draw.Src)
+						if diff := meanAbsDiff(want, decoded); diff > 4 {
+							t.Errorf("平均误差 %.2f 过大", diff)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+// 起点不为原点的子图按自身范围编码
+func TestEncodeJPEGSubImage(t *testing.T) {
+	src := testPattern(40, 40, false).SubImage(image.Rect(5, 9, 30, 20))
+	var buf bytes.Buffer
+	if err := EncodeJPEG(&buf, src, JPEGOptions{Quality: 95, Progressive: true, Subsampling: Subsampling444}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := image.NewRGBA(image.Rect(0, 0, 25, 11))
+	draw.Draw(want, want.Bounds(), src, src.Bounds().Min, draw.Src)
+	if got := decoded.Bounds().Size(); got != want.Bounds().Size() {
+		t.Fatalf("尺寸 = %v, 期望 %v", got, want.Bounds().Size())
+	}
+	if diff := meanAbsDiff(want, decoded); diff > 4 {
+		t.Errorf("平均误差 %.2f 过大", diff)
+	}
+}
+
+// 渐进式与基线编码使用相同的量化系数，解码结果应完全一致
+func TestEncodeJPEGProgressiveMatchesBaseline(t *testing.T) {
+	src := testPattern(37, 23, true)
+	for _, sub := range []ChromaSubsampling{Subsampling422, Subsampling444} {
+		var decoded [2]image.Image
+		for i, progressive := range []bool{false, true} {
+			var buf bytes.Buffer
+			if err := EncodeJPEG(&buf, src, JPEGOptions{Quality: 80, Progressive: progressive, Subsampling: sub}); err != nil {
+				t.Fatal(err)
+			}
+			img, err := jpeg.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded[i] = img
+		}
+		// 只比较图片范围内的像素，超出部分是 MCU 的填充
+		b := src.Bounds()
+	compare:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if decoded[0].At(x, y) != decoded[1].At(x, y) {
+					t.Errorf("sub=%d: 渐进式与基线的解码结果在 (%d, %d) 不一致", sub, x, y)
+					break compare
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package codec
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MetadataPolicy 输出图片的元数据处理策略
+type MetadataPolicy string
+
+const (
+	MetadataStrip    MetadataPolicy = "strip"     // 移除全部元数据
+	MetadataKeep     MetadataPolicy = "keep"      // 保留 EXIF、ICC 和 XMP（方向已校正，移除缩略图）
+	MetadataKeepSafe MetadataPolicy = "keep-safe" // 只保留 ICC 以及 EXIF 中的作者和版权信息
+)
+
+// ParseMetadataPolicy 解析元数据策略，为空时移除全部元数据
+func ParseMetadataPolicy(s string) (MetadataPolicy, error) {
+	switch policy := MetadataPolicy(strings.ToLower(s)); policy {
+	case "":
+		return MetadataStrip, nil
+	case MetadataStrip, MetadataKeep, MetadataKeepSafe:
+		return policy, nil
+	}
+	return "", errors.New("metadata 参数仅支持 strip、keep、keep-safe")
+}
+
+// EffectivePolicy 返回对输出格式实际生效的策略，BMP、TIFF 输出不写入元数据
+func EffectivePolicy(format string, policy MetadataPolicy) MetadataPolicy {
+	switch format {
+	case "jpeg", "png", "webp":
+		if policy != "" {
+			return policy
+		}
+	}
+	return MetadataStrip
+}
+
+// Metadata 图片携带的元数据
+type Metadata struct {
+	EXIF []byte // TIFF 结构的 EXIF 数据，不含 "Exif\x00\x00" 前缀
+	ICC  []byte // ICC 色彩配置文件
+	XMP  []byte // XMP 数据包
+}
+
+// Empty 是否不含任何元数据
+func (m Metadata) Empty() bool {
+	return len(m.EXIF) == 0 && len(m.ICC) == 0 && len(m.XMP) == 0
+}
+
+// xmpOrientation 匹配 XMP 中的 tiff:Orientation 属性或元素
+var xmpOrientation = regexp.MustCompile(`(tiff:Orientation(?:="|>))[2-8]`)
+
+// Apply 按策略筛选输出的元数据。像素在解码时已按方向校正，保留的方向标签一律重置为1
+func (m Metadata) Apply(policy MetadataPolicy) Metadata {
+	switch policy {
+	case MetadataKeep:
+		out := Metadata{ICC: m.ICC}
+		if x, err := parseEXIF(m.EXIF); err == nil {
+			x.resetOrientation()
+			out.EXIF = x.encode()
+		}
+		if len(m.XMP) > 0 {
+			out.XMP = xmpOrientation.ReplaceAll(m.XMP, []byte("${1}1"))
+		}
+		return out
+	case MetadataKeepSafe:
+		out := Metadata{ICC: m.ICC}
+		if x, err := parseEXIF(m.EXIF); err == nil {
+			x.filter(exifTagArtist, exifTagCopyright)
+			if len(x.ifd0) > 0 {
+				out.EXIF = x.encode()
+			}
+		}
+		return out
+	}
+	return Metadata{}
+}
+
+var (
+	jpegEXIFHeader = []byte("Exif\x00\x00")
+	jpegXMPHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegICCHeader  = []byte("ICC_PROFILE\x00")
+	pngSignature   = []byte("\x89PNG\r\n\x1a\n")
+	pngXMPKeyword  = "XML:com.adobe.xmp"
+)
+
+// ReadMetadata 从编码后的图片数据中读取元数据，格式不支持或数据损坏时返回空结果
+func ReadMetadata(data []byte, format string) Metadata {
+	switch format {
+	case "jpeg":
+		return readJPEGMetadata(data)
+	case "png":
+		return readPNGMetadata(data)
+	case "webp":
+		return readWebPMetadata(data)
+	}
+	return Metadata{}
+}
+
+// readJPEGMetadata 读取 SOS 之前的 APP1（EXIF、XMP）和 APP2（ICC，可能分多段）
+func readJPEGMetadata(data []byte) Metadata {
+	var m Metadata
+	iccChunks := make(map[int][]byte)
+
+	for p := 2; p+4 <= len(data) && data[p] == 0xff; {
+		marker := data[p+1]
+		if marker == 0xd8 || marker >= 0xd0 && marker <= 0xd7 || marker == 0x01 || marker == 0xff {
+			p++
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[p+2:]))
+		if length < 2 || p+2+length > len(data) {
+			break
+		}
+		payload := data[p+4 : p+2+length]
+
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(payload, jpegEXIFHeader) && m.EXIF == nil:
+			m.EXIF = append([]byte(nil), payload[len(jpegEXIFHeader):]...)
+		case marker == 0xe1 && bytes.HasPrefix(payload, jpegXMPHeader) && m.XMP == nil:
+			m.XMP = append([]byte(nil), payload[len(jpegXMPHeader):]...)
+		case marker == 0xe2 && bytes.HasPrefix(payload, jpegICCHeader) && len(payload) > len(jpegICCHeader)+2:
+			seq := int(payload[len(jpegICCHeader)])
+			iccChunks[seq] = payload[len(jpegICCHeader)+2:]
+		}
+		p += 2 + length
+	}
+
+	if len(iccChunks) > 0 {
+		seqs := make([]int, 0, len(iccChunks))
+		for seq := range iccChunks {
+			seqs = append(seqs, seq)
+		}
+		sort.Ints(seqs)
+		for _, seq := range seqs {
+			m.ICC = append(m.ICC, iccChunks[seq]...)
+		}
+	}
+	return m
+}
+
+// readPNGMetadata 读取 eXIf、iCCP 和 XMP 的 iTXt 块
+func readPNGMetadata(data []byte) Metadata {
+	var m Metadata
+	if !bytes.HasPrefix(data, pngSignature) {
+		return m
+	}
+
+	for p := len(pngSignature); p+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[p:]))
+		if length < 0 || p+12+length > len(data) {
+			break
+		}
+		typ := string(data[p+4 : p+8])
+		chunk := data[p+8 : p+8+length]
+		p += 12 + length
+
+		switch typ {
+		case "eXIf":
+			m.EXIF = append([]byte(nil), chunk...)
+		case "iCCP":
+			// 配置文件名称\0 压缩方式(1字节) zlib数据
+			i := bytes.IndexByte(chunk, 0)
+			if i < 0 || i+2 > len(chunk) {
+				continue
+			}
+			if icc, err := inflate(chunk[i+2:]); err == nil {
+				m.ICC = icc
+			}
+		case "iTXt":
+			// 关键字\0 压缩标志 压缩方式 语言标签\0 翻译关键字\0 文本
+			fields := bytes.SplitN(chunk, []byte{0}, 2)
+			if len(fields) != 2 || string(fields[0]) != pngXMPKeyword || len(fields[1]) < 2 {
+				continue
+			}
+			compressed, rest := fields[1][0] == 1, fields[1][2:]
+			parts := bytes.SplitN(rest, []byte{0}, 3)
+			if len(parts) != 3 {
+				continue
+			}
+			text := parts[2]
+			if compressed {
+				var err error
+				if text, err = inflate(text); err != nil {
+					continue
+				}
+			}
+			m.XMP = append([]byte(nil), text...)
+		case "IEND":
+			return m
+		}
+	}
+	return m
+}
+
+// readWebPMetadata 读取扩展格式中的 ICCP、EXIF 和 XMP 块
+func readWebPMetadata(data []byte) Metadata {
+	var m Metadata
+	for _, c := range webpChunks(data) {
+		switch c.id {
+		case "ICCP":
+			m.ICC = append([]byte(nil), c.data...)
+		case "EXIF":
+			// 部分编码器会保留 JPEG 的 "Exif\0\0" 前缀
+			m.EXIF = append([]byte(nil), bytes.TrimPrefix(c.data, jpegEXIFHeader)...)
+		case "XMP ":
+			m.XMP = append([]byte(nil), c.data...)
+		}
+	}
+	return m
+}
+
+// webpChunk RIFF 容器中的数据块
+type webpChunk struct {
+	id   string
+	data []byte
+}
+
+// webpChunks 拆分 WebP 的 RIFF 容器，格式无效时返回 nil
+func webpChunks(data []byte) []webpChunk {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil
+	}
+	var chunks []webpChunk
+	for p := 12; p+8 <= len(data); {
+		id := string(data[p : p+4])
+		size := int(binary.LittleEndian.Uint32(data[p+4:]))
+		if size < 0 || p+8+size > len(data) {
+			break
+		}
+		chunks = append(chunks, webpChunk{id: id, data: data[p+8 : p+8+size]})
+		p += 8 + size + size&1
+	}
+	return chunks
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, 16<<20))
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// embedJPEGMetadata 在 SOI 和 JFIF APP0 之后插入元数据段
+func embedJPEGMetadata(data []byte, m Metadata) []byte {
+	if len(data) < 2 {
+		return data
+	}
+	insert := 2
+	if len(data) >= 6 && data[2] == 0xff && data[3] == 0xe0 {
+		insert = 4 + int(binary.BigEndian.Uint16(data[4:]))
+	}
+
+	const maxPayload = 65533
+	var segments bytes.Buffer
+	writeSegment := func(marker byte, parts ...[]byte) {
+		size := 2
+		for _, part := range parts {
+			size += len(part)
+		}
+		segments.Write([]byte{0xff, marker, byte(size >> 8), byte(size)})
+		for _, part := range parts {
+			segments.Write(part)
+		}
+	}
+
+	if len(m.EXIF) > 0 && len(jpegEXIFHeader)+len(m.EXIF) <= maxPayload {
+		writeSegment(0xe1, jpegEXIFHeader, m.EXIF)
+	}
+	if len(m.XMP) > 0 && len(jpegXMPHeader)+len(m.XMP) <= maxPayload {
+		writeSegment(0xe1, jpegXMPHeader, m.XMP)
+	}
+	if len(m.ICC) > 0 {
+		// ICC 配置文件按段拆分，每段带序号和总段数
+		chunkSize := maxPayload - len(jpegICCHeader) - 2
+		count := (len(m.ICC) + chunkSize - 1) / chunkSize
+		if count <= 255 {
+			for i := 0; i < count; i++ {
+				chunk := m.ICC[i*chunkSize : min((i+1)*chunkSize, len(m.ICC))]
+				writeSegment(0xe2, jpegICCHeader, []byte{byte(i + 1), byte(count)}, chunk)
+			}
+		}
+	}
+
+	out := make([]byte, 0, len(data)+segments.Len())
+	out = append(out, data[:insert]...)
+	out = append(out, segments.Bytes()...)
+	return append(out, data[insert:]...)
+}
+
+// embedPNGMetadata 在 IHDR 之后插入 iCCP、eXIf 和 XMP iTXt 块
+func embedPNGMetadata(data []byte, m Metadata) []byte {
+	const ihdrEnd = 8 + 12 + 13
+	if len(data) < ihdrEnd || !bytes.HasPrefix(data, pngSignature) {
+		return data
+	}
+
+	var chunks bytes.Buffer
+	writeChunk := func(typ string, parts ...[]byte) {
+		size := 0
+		for _, part := range parts {
+			size += len(part)
+		}
+		var header [8]byte
+		binary.BigEndian.PutUint32(header[:4], uint32(size))
+		copy(header[4:], typ)
+		chunks.Write(header[:])
+
+		crc := crc32.NewIEEE()
+		crc.Write(header[4:])
+		for _, part := range parts {
+			chunks.Write(part)
+			crc.Write(part)
+		}
+		binary.Write(&chunks, binary.BigEndian, crc.Sum32())
+	}
+
+	if len(m.ICC) > 0 {
+		writeChunk("iCCP", []byte("ICC Profile\x00\x00"), deflate(m.ICC))
+	}
+	if len(m.EXIF) > 0 {
+		writeChunk("eXIf", m.EXIF)
+	}
+	if len(m.XMP) > 0 {
+		writeChunk("iTXt", []byte(pngXMPKeyword+"\x00\x00\x00\x00\x00"), m.XMP)
+	}
+
+	out := make([]byte, 0, len(data)+chunks.Len())
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunks.Bytes()...)
+	return append(out, data[ihdrEnd:]...)
+}
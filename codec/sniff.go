@@ -0,0 +1,23 @@
+package codec
+
+import "bytes"
+
+// SniffLen 识别格式所需的文件头长度
+const SniffLen = 12
+
+// Sniff 根据文件头的魔数识别图片格式，无法识别时返回空字符串
+func Sniff(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xff\xd8\xff")):
+		return "jpeg"
+	case bytes.HasPrefix(head, pngSignature):
+		return "png"
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return "webp"
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return "tiff"
+	case bytes.HasPrefix(head, []byte("BM")):
+		return "bmp"
+	}
+	return ""
+}
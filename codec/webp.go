@@ -0,0 +1,738 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+// 纯Go实现的 WebP 无损(VP8L)编码器。
+// 依次应用减绿变换和预测变换，残差经LZ77回溯引用和颜色缓存后
+// 使用单组规范哈夫曼码编码。
+
+const (
+	webpMaxSize       = 1 << 14 // VP8L 宽高上限
+	vp8lPredictorBits = 4       // 预测变换分块大小为 16x16
+	vp8lMaxCodeLength = 15      // 像素哈夫曼码最大码长
+	vp8lMaxCLLength   = 7       // 码长哈夫曼码最大码长
+	vp8lNumPredictors = 14
+
+	vp8lCacheBits       = 10 // 颜色缓存大小为 1024
+	vp8lCacheMultiplier = 0x1e35a7bd
+	vp8lGreenAlphabet   = 256 + 24 + 1<<vp8lCacheBits
+	vp8lDistAlphabet    = 40
+
+	vp8lHashBits    = 16
+	vp8lMaxChain    = 32 // 哈希链最大查找次数
+	vp8lMinMatch    = 3
+	vp8lMaxMatch    = 4096
+	vp8lMaxDistance = 1<<20 - 120
+)
+
+// vp8lCodeLengthOrder 码长码的码长写入顺序
+var vp8lCodeLengthOrder = [19]uint8{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lDistanceMap 距离码 1-120 对应的二维偏移，高4位为行偏移，低4位为 8 减列偏移
+var vp8lDistanceMap = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// EncodeWebP 将图片编码为无损WebP
+func EncodeWebP(w io.Writer, img image.Image) error {
+	return encodeWebP(w, img, Metadata{})
+}
+
+// encodeWebP 编码无损WebP，有元数据时使用带 VP8X 头的扩展格式
+func encodeWebP(w io.Writer, img image.Image, m Metadata) error {
+	data, err := encodeVP8L(img)
+	if err != nil {
+		return err
+	}
+	if m.Empty() {
+		return writeRIFF(w, []webpChunk{{id: "VP8L", data: data}})
+	}
+
+	const (
+		xmpBit   = 1 << 2
+		exifBit  = 1 << 3
+		alphaBit = 1 << 4
+		iccBit   = 1 << 5
+	)
+	b := img.Bounds()
+	vp8x := make([]byte, 10)
+	if data[4]&0x10 != 0 {
+		vp8x[0] |= alphaBit // VP8L 头部的 alpha_is_used 标志
+	}
+	putUint24(vp8x[4:], uint32(b.Dx()-1))
+	putUint24(vp8x[7:], uint32(b.Dy()-1))
+
+	// 块顺序: VP8X、ICCP、图像数据、EXIF、XMP
+	chunks := []webpChunk{{id: "VP8X", data: vp8x}}
+	if len(m.ICC) > 0 {
+		vp8x[0] |= iccBit
+		chunks = append(chunks, webpChunk{id: "ICCP", data: m.ICC})
+	}
+	chunks = append(chunks, webpChunk{id: "VP8L", data: data})
+	if len(m.EXIF) > 0 {
+		vp8x[0] |= exifBit
+		chunks = append(chunks, webpChunk{id: "EXIF", data: m.EXIF})
+	}
+	if len(m.XMP) > 0 {
+		vp8x[0] |= xmpBit
+		chunks = append(chunks, webpChunk{id: "XMP ", data: m.XMP})
+	}
+	return writeRIFF(w, chunks)
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// writeRIFF 写入 RIFF 容器，奇数长度的块补齐一个字节
+func writeRIFF(w io.Writer, chunks []webpChunk) error {
+	size := 4
+	for _, c := range chunks {
+		size += 8 + len(c.data) + len(c.data)&1
+	}
+
+	buf := make([]byte, 0, 8+size)
+	buf = append(buf, "RIFF"...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(size))
+	buf = append(buf, "WEBP"...)
+	for _, c := range chunks {
+		buf = append(buf, c.id...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(c.data)))
+		buf = append(buf, c.data...)
+		if len(c.data)&1 == 1 {
+			buf = append(buf, 0)
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// encodeVP8L 生成 VP8L 位流
+func encodeVP8L(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= 0 || height <= 0 || width > webpMaxSize || height > webpMaxSize {
+		return nil, errors.New("webp: 图片尺寸无效，宽高需在1-16384之间")
+	}
+
+	// 转换为非预乘的 RGBA 字节序列，与解码器内部布局一致
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	pix := nrgba.Pix
+
+	hasAlpha := uint32(0)
+	for i := 3; i < len(pix); i += 4 {
+		if pix[i] != 0xff {
+			hasAlpha = 1
+			break
+		}
+	}
+
+	bw := &vp8lWriter{buf: make([]byte, 0, len(pix)/2)}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.write(hasAlpha, 1)
+	bw.write(0, 3)
+
+	// 减绿变换
+	for i := 0; i < len(pix); i += 4 {
+		pix[i+0] -= pix[i+1]
+		pix[i+2] -= pix[i+1]
+	}
+	bw.write(1, 1)
+	bw.write(2, 2)
+
+	// 预测变换，模式图作为子图像写入
+	modes, residuals := vp8lPredict(pix, width, height)
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(vp8lPredictorBits-2, 3)
+	bw.writeImageData(modes, tilesWidth(width), false)
+
+	bw.write(0, 1)
+	bw.writeImageData(residuals, width, true)
+	bw.flush()
+	return bw.buf, nil
+}
+
+// vp8lPredict 为每个分块选择残差最小的预测模式，返回模式图和残差图像
+func vp8lPredict(pix []uint8, width, height int) (modes, residuals []uint8) {
+	tilesW, tilesH := tilesWidth(width), tilesWidth(height)
+	modes = make([]uint8, 4*tilesW*tilesH)
+	residuals = make([]uint8, len(pix))
+	stride := 4 * width
+
+	for ty := 0; ty < tilesH; ty++ {
+		for tx := 0; tx < tilesW; tx++ {
+			x0, y0 := tx<<vp8lPredictorBits, ty<<vp8lPredictorBits
+			x1, y1 := min(x0+1<<vp8lPredictorBits, width), min(y0+1<<vp8lPredictorBits, height)
+
+			// 首行和首列使用固定预测，不参与模式评估
+			best, bestCost := 0, -1
+			for mode := 0; mode < vp8lNumPredictors; mode++ {
+				cost := 0
+				for y := max(y0, 1); y < y1; y++ {
+					for x := max(x0, 1); x < x1; x++ {
+						p := y*stride + 4*x
+						pred := vp8lPredictPixel(mode, pix, p, p-stride)
+						for c := 0; c < 4; c++ {
+							cost += vp8lResidualCost(pix[p+c] - pred[c])
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			i := 4 * (ty*tilesW + tx)
+			modes[i+1] = uint8(best)
+			modes[i+3] = 0xff
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := y*stride + 4*x
+			var pred [4]uint8
+			switch {
+			case y == 0 && x == 0:
+				pred = [4]uint8{0, 0, 0, 0xff}
+			case y == 0:
+				pred = vp8lPredictPixel(1, pix, p, 0)
+			case x == 0:
+				pred = vp8lPredictPixel(2, pix, p, p-stride)
+			default:
+				i := 4 * ((y>>vp8lPredictorBits)*tilesW + x>>vp8lPredictorBits)
+				pred = vp8lPredictPixel(int(modes[i+1]), pix, p, p-stride)
+			}
+			for c := 0; c < 4; c++ {
+				residuals[p+c] = pix[p+c] - pred[c]
+			}
+		}
+	}
+	return modes, residuals
+}
+
+// tilesWidth 预测变换分块数量
+func tilesWidth(n int) int {
+	return (n + 1<<vp8lPredictorBits - 1) >> vp8lPredictorBits
+}
+
+// vp8lResidualCost 残差的近似编码代价
+func vp8lResidualCost(r uint8) int {
+	return absInt(int(int8(r)))
+}
+
+// vp8lPredictPixel 按预测模式计算像素 p 的预测值，top 为上一行同列像素的偏移。
+// 最右列的右上像素按规范取当前行首像素，恰好是 top+4 处的数据。
+func vp8lPredictPixel(mode int, pix []uint8, p, top int) (pred [4]uint8) {
+	l, t := pix[p-4:p], pix[top:top+4]
+	var tl, tr []uint8
+	if mode >= 3 {
+		tl, tr = pix[top-4:top], pix[top+4:top+8]
+	}
+
+	switch mode {
+	case 0:
+		pred[3] = 0xff
+	case 1:
+		copy(pred[:], l)
+	case 2:
+		copy(pred[:], t)
+	case 3:
+		copy(pred[:], tr)
+	case 4:
+		copy(pred[:], tl)
+	case 11:
+		var pl, pt int
+		for c := 0; c < 4; c++ {
+			pl += absInt(int(tl[c]) - int(t[c]))
+			pt += absInt(int(tl[c]) - int(l[c]))
+		}
+		if pl < pt {
+			copy(pred[:], l)
+		} else {
+			copy(pred[:], t)
+		}
+	default:
+		for c := 0; c < 4; c++ {
+			switch mode {
+			case 5:
+				pred[c] = avg2(avg2(l[c], tr[c]), t[c])
+			case 6:
+				pred[c] = avg2(l[c], tl[c])
+			case 7:
+				pred[c] = avg2(l[c], t[c])
+			case 8:
+				pred[c] = avg2(tl[c], t[c])
+			case 9:
+				pred[c] = avg2(t[c], tr[c])
+			case 10:
+				pred[c] = avg2(avg2(l[c], tl[c]), avg2(t[c], tr[c]))
+			case 12:
+				pred[c] = clampByte(int(l[c]) + int(t[c]) - int(tl[c]))
+			case 13:
+				a := int(avg2(l[c], t[c]))
+				pred[c] = clampByte(a + (a-int(tl[c]))/2)
+			}
+		}
+	}
+	return pred
+}
+
+func avg2(a, b uint8) uint8 {
+	return uint8((int(a) + int(b)) / 2)
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func clampByte(x int) uint8 {
+	if x < 0 {
+		return 0
+	}
+	if x > 255 {
+		return 255
+	}
+	return uint8(x)
+}
+
+// vp8lWriter 按低位优先顺序写入位流
+type vp8lWriter struct {
+	buf   []byte
+	bits  uint64
+	nBits uint
+}
+
+func (bw *vp8lWriter) write(v uint32, n uint) {
+	bw.bits |= uint64(v) << bw.nBits
+	bw.nBits += n
+	for bw.nBits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits >>= 8
+		bw.nBits -= 8
+	}
+}
+
+func (bw *vp8lWriter) flush() {
+	if bw.nBits > 0 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+	}
+	bw.bits, bw.nBits = 0, 0
+}
+
+// writeImageData 写入熵编码图像：颜色缓存参数、元前缀码标志（仅顶层）、五个哈夫曼码和像素
+func (bw *vp8lWriter) writeImageData(pix []uint8, width int, topLevel bool) {
+	bw.write(1, 1)
+	bw.write(vp8lCacheBits, 4)
+	if topLevel {
+		bw.write(0, 1) // 单组哈夫曼码
+	}
+
+	argb := make([]uint32, len(pix)/4)
+	for i := range argb {
+		argb[i] = uint32(pix[4*i+3])<<24 | uint32(pix[4*i+0])<<16 | uint32(pix[4*i+1])<<8 | uint32(pix[4*i+2])
+	}
+	symbols := vp8lBackwardRefs(argb, width)
+
+	green := make([]uint32, vp8lGreenAlphabet)
+	red := make([]uint32, 256)
+	blue := make([]uint32, 256)
+	alpha := make([]uint32, 256)
+	dist := make([]uint32, vp8lDistAlphabet)
+	for _, s := range symbols {
+		switch s.kind {
+		case vp8lLiteral:
+			alpha[s.value>>24]++
+			red[s.value>>16&0xff]++
+			green[s.value>>8&0xff]++
+			blue[s.value&0xff]++
+		case vp8lCacheIndex:
+			green[256+24+s.value]++
+		case vp8lCopy:
+			lengthSymbol, _, _ := vp8lPrefixEncode(s.value)
+			distSymbol, _, _ := vp8lPrefixEncode(s.dist)
+			green[256+lengthSymbol]++
+			dist[distSymbol]++
+		}
+	}
+
+	codes := [5]vp8lCode{
+		bw.writeHuffmanCode(green),
+		bw.writeHuffmanCode(red),
+		bw.writeHuffmanCode(blue),
+		bw.writeHuffmanCode(alpha),
+		bw.writeHuffmanCode(dist),
+	}
+
+	for _, s := range symbols {
+		switch s.kind {
+		case vp8lLiteral:
+			codes[0].writeSymbol(bw, int(s.value>>8&0xff))
+			codes[1].writeSymbol(bw, int(s.value>>16&0xff))
+			codes[2].writeSymbol(bw, int(s.value&0xff))
+			codes[3].writeSymbol(bw, int(s.value>>24))
+		case vp8lCacheIndex:
+			codes[0].writeSymbol(bw, int(256+24+s.value))
+		case vp8lCopy:
+			symbol, n, extra := vp8lPrefixEncode(s.value)
+			codes[0].writeSymbol(bw, int(256+symbol))
+			bw.write(extra, n)
+			symbol, n, extra = vp8lPrefixEncode(s.dist)
+			codes[4].writeSymbol(bw, int(symbol))
+			bw.write(extra, n)
+		}
+	}
+}
+
+// vp8lSymbol 熵编码前的像素符号
+type vp8lSymbol struct {
+	kind  uint8
+	value uint32 // 字面像素的ARGB值、颜色缓存索引或回溯长度
+	dist  uint32 // 回溯距离码
+}
+
+const (
+	vp8lLiteral = iota
+	vp8lCacheIndex
+	vp8lCopy
+)
+
+// vp8lBackwardRefs 使用哈希链贪心查找LZ77回溯引用，未命中时尝试颜色缓存
+func vp8lBackwardRefs(argb []uint32, width int) []vp8lSymbol {
+	n := len(argb)
+	symbols := make([]vp8lSymbol, 0, n)
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	hash := func(i int) uint32 {
+		return (argb[i]*vp8lCacheMultiplier + argb[i+1]*0x9e3779b1) >> (32 - vp8lHashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	distCodes := vp8lDistanceCodes(width)
+	var cache [1 << vp8lCacheBits]uint32
+	cacheIndex := func(v uint32) uint32 { return (v * vp8lCacheMultiplier) >> (32 - vp8lCacheBits) }
+
+	for i := 0; i < n; {
+		bestLength, bestDist := 0, 0
+		if i+1 < n {
+			chain := 0
+			for j := int(head[hash(i)]); j >= 0 && chain < vp8lMaxChain && i-j <= vp8lMaxDistance; j, chain = int(prev[j]), chain+1 {
+				l := 0
+				for l < vp8lMaxMatch && i+l < n && argb[j+l] == argb[i+l] {
+					l++
+				}
+				if l > bestLength {
+					bestLength, bestDist = l, i-j
+				}
+			}
+		}
+
+		if bestLength >= vp8lMinMatch {
+			code, ok := distCodes[bestDist]
+			if !ok {
+				code = bestDist + len(vp8lDistanceMap)
+			}
+			symbols = append(symbols, vp8lSymbol{kind: vp8lCopy, value: uint32(bestLength), dist: uint32(code)})
+			for k := i; k < i+bestLength; k++ {
+				insert(k)
+				cache[cacheIndex(argb[k])] = argb[k]
+			}
+			i += bestLength
+			continue
+		}
+
+		idx := cacheIndex(argb[i])
+		if cache[idx] == argb[i] {
+			symbols = append(symbols, vp8lSymbol{kind: vp8lCacheIndex, value: idx})
+		} else {
+			symbols = append(symbols, vp8lSymbol{kind: vp8lLiteral, value: argb[i]})
+			cache[idx] = argb[i]
+		}
+		insert(i)
+		i++
+	}
+	return symbols
+}
+
+// vp8lDistanceCodes 计算二维邻域距离码到实际像素距离的反向映射，同一距离取最小的码
+func vp8lDistanceCodes(width int) map[int]int {
+	codes := make(map[int]int, len(vp8lDistanceMap))
+	for i := len(vp8lDistanceMap) - 1; i >= 0; i-- {
+		yOffset, xOffset := int(vp8lDistanceMap[i]>>4), 8-int(vp8lDistanceMap[i]&0xf)
+		if d := yOffset*width + xOffset; d >= 1 {
+			codes[d] = i + 1
+		}
+	}
+	return codes
+}
+
+// vp8lPrefixEncode 将回溯长度或距离码编码为前缀符号和额外位
+func vp8lPrefixEncode(v uint32) (symbol uint32, extraBits uint, extra uint32) {
+	v--
+	if v < 4 {
+		return v, 0, 0
+	}
+	hb := uint(bits.Len32(v) - 1)
+	second := v >> (hb - 1) & 1
+	return uint32(2*hb) + second, hb - 1, v & (1<<(hb-1) - 1)
+}
+
+// vp8lCode 规范哈夫曼码
+type vp8lCode struct {
+	lengths []uint8
+	codes   []uint16 // 已按位反转，可直接写入位流
+	trivial bool     // 只有一个符号时不占用任何位
+}
+
+func (c *vp8lCode) writeSymbol(bw *vp8lWriter, symbol int) {
+	if !c.trivial {
+		bw.write(uint32(c.codes[symbol]), uint(c.lengths[symbol]))
+	}
+}
+
+// writeHuffmanCode 根据符号频率生成并写入哈夫曼码，不超过两个符号时使用简单码
+func (bw *vp8lWriter) writeHuffmanCode(freq []uint32) vp8lCode {
+	var used []int
+	for symbol, f := range freq {
+		if f > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		bw.write(1, 1)
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+
+		code := vp8lCode{lengths: make([]uint8, len(freq)), codes: make([]uint16, len(freq))}
+		if len(used) == 1 {
+			code.trivial = true
+			return code
+		}
+		bw.write(uint32(used[1]), 8)
+		code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+		code.codes[used[1]] = 1
+		return code
+	}
+
+	code := newVP8LCode(freq, vp8lMaxCodeLength)
+	tokens := vp8lCodeLengthTokens(code.lengths)
+
+	clFreq := make([]uint32, len(vp8lCodeLengthOrder))
+	for _, t := range tokens {
+		clFreq[t.symbol]++
+	}
+	clCode := newVP8LCode(clFreq, vp8lMaxCLLength)
+
+	numCodes := 4
+	for i, symbol := range vp8lCodeLengthOrder {
+		if clCode.lengths[symbol] > 0 && i+1 > numCodes {
+			numCodes = i + 1
+		}
+	}
+
+	bw.write(0, 1)
+	bw.write(uint32(numCodes-4), 4)
+	for _, symbol := range vp8lCodeLengthOrder[:numCodes] {
+		bw.write(uint32(clCode.lengths[symbol]), 3)
+	}
+	bw.write(0, 1) // 码长数量等于字母表大小
+	for _, t := range tokens {
+		clCode.writeSymbol(bw, int(t.symbol))
+		if t.extraBits > 0 {
+			bw.write(uint32(t.extra), t.extraBits)
+		}
+	}
+	return code
+}
+
+// vp8lToken 码长序列的游程编码符号：0-15 为码长，16 重复前一个非零码长，17/18 重复零
+type vp8lToken struct {
+	symbol    uint8
+	extra     uint8
+	extraBits uint
+}
+
+func vp8lCodeLengthTokens(lengths []uint8) []vp8lToken {
+	var tokens []vp8lToken
+	for i := 0; i < len(lengths); {
+		v, run := lengths[i], 1
+		for i+run < len(lengths) && lengths[i+run] == v {
+			run++
+		}
+		i += run
+
+		if v == 0 {
+			for run >= 3 {
+				if run >= 11 {
+					n := min(run, 138)
+					tokens = append(tokens, vp8lToken{18, uint8(n - 11), 7})
+					run -= n
+				} else {
+					n := min(run, 10)
+					tokens = append(tokens, vp8lToken{17, uint8(n - 3), 3})
+					run -= n
+				}
+			}
+		} else {
+			tokens = append(tokens, vp8lToken{symbol: v})
+			run--
+			for run >= 3 {
+				n := min(run, 6)
+				tokens = append(tokens, vp8lToken{16, uint8(n - 3), 2})
+				run -= n
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, vp8lToken{symbol: v})
+		}
+	}
+	return tokens
+}
+
+// newVP8LCode 由频率生成限长规范哈夫曼码；超过码长上限时将频率减半后重建
+func newVP8LCode(freq []uint32, maxLength int) vp8lCode {
+	f := append([]uint32(nil), freq...)
+	lengths := make([]uint8, len(freq))
+	for vp8lCodeLengths(f, lengths) > maxLength {
+		for i := range f {
+			if f[i] > 0 {
+				f[i] = (f[i] + 1) / 2
+			}
+		}
+	}
+
+	code := vp8lCode{lengths: lengths, codes: make([]uint16, len(freq))}
+	used := 0
+	var count [vp8lMaxCodeLength + 1]int
+	for _, l := range lengths {
+		if l > 0 {
+			used++
+		}
+		count[l]++
+	}
+	if used == 1 {
+		code.trivial = true
+		return code
+	}
+
+	var next [vp8lMaxCodeLength + 1]int
+	c := 0
+	count[0] = 0
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		c = (c + count[l-1]) << 1
+		next[l] = c
+	}
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		v := next[l]
+		next[l]++
+		var rev uint16
+		for k := uint8(0); k < l; k++ {
+			rev = rev<<1 | uint16(v>>k&1)
+		}
+		code.codes[symbol] = rev
+	}
+	return code
+}
+
+// vp8lCodeLengths 计算哈夫曼码长，写入 lengths 并返回最大码长
+func vp8lCodeLengths(freq []uint32, lengths []uint8) int {
+	type node struct {
+		freq   uint32
+		symbol int
+		parent int
+	}
+
+	var leaves []node
+	for symbol, f := range freq {
+		lengths[symbol] = 0
+		if f > 0 {
+			leaves = append(leaves, node{freq: f, symbol: symbol})
+		}
+	}
+	switch len(leaves) {
+	case 0:
+		return 0
+	case 1:
+		lengths[leaves[0].symbol] = 1
+		return 1
+	}
+	sort.SliceStable(leaves, func(i, j int) bool { return leaves[i].freq < leaves[j].freq })
+
+	// 双队列合并：叶子按频率有序，新生成的内部节点频率单调不减
+	n := len(leaves)
+	nodes := make([]node, n, 2*n-1)
+	copy(nodes, leaves)
+	li, ni := 0, n
+	pick := func() int {
+		if li < n && (ni >= len(nodes) || nodes[li].freq <= nodes[ni].freq) {
+			li++
+			return li - 1
+		}
+		ni++
+		return ni - 1
+	}
+	for k := 0; k < n-1; k++ {
+		a, b := pick(), pick()
+		nodes = append(nodes, node{freq: nodes[a].freq + nodes[b].freq, symbol: -1})
+		nodes[a].parent, nodes[b].parent = len(nodes)-1, len(nodes)-1
+	}
+
+	depth := make([]int, len(nodes))
+	maxDepth := 0
+	for k := len(nodes) - 2; k >= 0; k-- {
+		depth[k] = depth[nodes[k].parent] + 1
+		if k < n {
+			lengths[nodes[k].symbol] = uint8(depth[k])
+			maxDepth = max(maxDepth, depth[k])
+		}
+	}
+	return maxDepth
+}
@@ -0,0 +1,107 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// noisePattern 生成随机像素的图片，覆盖更多的 Huffman 符号；alpha 为 false 时完全不透明
+func noisePattern(w, h int, alpha bool) *image.NRGBA {
+	rng := rand.New(rand.NewSource(int64(w*1000 + h)))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rng.Read(img.Pix)
+	if !alpha {
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 0xff
+		}
+	}
+	return img
+}
+
+// assertSamePixels 检查 got 与 want 的像素完全一致；完全透明的像素只比较透明度
+func assertSamePixels(t *testing.T, want image.Image, got image.Image) {
+	t.Helper()
+	if got.Bounds().Size() != want.Bounds().Size() {
+		t.Fatalf("尺寸 = %v, 期望 %v", got.Bounds().Size(), want.Bounds().Size())
+	}
+	wb, gb := want.Bounds(), got.Bounds()
+	for y := 0; y < wb.Dy(); y++ {
+		for x := 0; x < wb.Dx(); x++ {
+			w := color.NRGBAModel.Convert(want.At(wb.Min.X+x, wb.Min.Y+y)).(color.NRGBA)
+			g := color.NRGBAModel.Convert(got.At(gb.Min.X+x, gb.Min.Y+y)).(color.NRGBA)
+			if w.A == 0 {
+				w, g = color.NRGBA{A: w.A}, color.NRGBA{A: g.A}
+			}
+			if w != g {
+				t.Fatalf("(%d, %d) = %v, 期望 %v", x, y, g, w)
+			}
+		}
+	}
+}
+
+// 无损 WebP 经 x/image/webp 解码后与输入逐像素一致
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	sizes := [][2]int{{1, 1}, {3, 7}, {33, 17}, {100, 1}, {1, 64}, {129, 65}}
+	for _, size := range sizes {
+		for _, alpha := range []bool{false, true} {
+			for _, pattern := range []struct {
+				name string
+				img  *image.NRGBA
+			}{
+				{"gradient", testPattern(size[0], size[1], alpha)},
+				{"noise", noisePattern(size[0], size[1], alpha)},
+			} {
+				t.Run(fmt.Sprintf("%dx%d/alpha=%v/%s", size[0], size[1], alpha, pattern.name), func(t *testing.T) {
+					var buf bytes.Buffer
+					if err := EncodeWebP(&buf, pattern.img); err != nil {
+						t.Fatal(err)
+					}
+					decoded, err := webp.Decode(&buf)
+					if err != nil {
+						t.Fatalf("x/image/webp 无法解码: %v", err)
+					}
+					assertSamePixels(t, pattern.img, decoded)
+				})
+			}
+		}
+	}
+}
+
+// 带元数据时使用 VP8X 扩展格式，图像数据和元数据都能读回
+func TestEncodeWebPWithMetadata(t *testing.T) {
+	src := testPattern(21, 13, true).SubImage(image.Rect(2, 3, 21, 13))
+	var buf bytes.Buffer
+	err := Encode(&buf, "webp", src, Options{
+		MetadataPolicy: MetadataKeep,
+		Metadata:       Metadata{XMP: []byte("<x:xmpmeta/>")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes()[:16], []byte("VP8X")) {
+		t.Error("带元数据的输出应使用 VP8X 扩展格式")
+	}
+	// x/image/webp 不支持不含 ALPH 块的 VP8X，通过 Decode 去掉扩展块后解码
+	decoded, format, meta, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "webp" || string(meta.XMP) != "<x:xmpmeta/>" {
+		t.Errorf("format = %q, XMP = %q", format, meta.XMP)
+	}
+	assertSamePixels(t, src, decoded)
+}
+
+func TestEncodeWebPTooLarge(t *testing.T) {
+	for _, r := range []image.Rectangle{image.Rect(0, 0, 16385, 1), image.Rect(0, 0, 1, 16385), image.Rect(0, 0, 0, 0)} {
+		if err := EncodeWebP(&bytes.Buffer{}, image.NewNRGBA(r)); err == nil {
+			t.Errorf("%v: 超出 WebP 尺寸范围应返回错误", r.Size())
+		}
+	}
+}
@@ -2,13 +2,37 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Neurocoda/Antimg/codec"
 )
 
 type Config struct {
-	Port          string
-	JWTSecret     string
-	AdminUsername string
-	AdminPassword string
+	Port           string
+	JWTSecret      string
+	AdminUsername  string
+	AdminPassword  string
+	PresetsFile    string        // 自定义攻击预设配置文件（JSON）
+	ProcessTimeout time.Duration // 单次图片处理超时时间
+
+	// 异步任务
+	JobWorkers   int           // 并发处理任务的worker数量
+	JobQueueSize int           // 等待队列容量
+	JobTimeout   time.Duration // 单个任务的处理超时时间
+	JobResultTTL time.Duration // 已结束任务及结果的保留时间
+	JobResultMB  int           // 保留的任务结果总大小上限（MB），超出时提前删除最早完成的任务
+
+	BatchMaxFiles int    // 批处理单次最多文件数
+	OutputSuffix  string // 输出文件名后缀，追加在原始文件名之后
+
+	// 输入图片像素数限制
+	MaxMegapixels       int    // 允许处理的最大像素数（百万像素）
+	OversizeMode        string // 超出限制时的处理方式: reject 或 downscale
+	MaxDecodeMegapixels int    // downscale 模式下允许解码的最大像素数（百万像素）
+
+	AllowedFormats []string // 允许上传的图片格式（按文件内容识别）
 }
 
 var AppConfig *Config
@@ -24,10 +48,30 @@ func Init() {
 	}
 
 	AppConfig = &Config{
-		Port:          getEnv("PORT", "8080"),
-		JWTSecret:     jwtSecret,
-		AdminUsername: getEnv("ADMIN_USERNAME", "admin"),
-		AdminPassword: getEnv("ADMIN_PASSWORD", "password"),
+		Port:           getEnv("PORT", "8080"),
+		JWTSecret:      jwtSecret,
+		AdminUsername:  getEnv("ADMIN_USERNAME", "admin"),
+		AdminPassword:  getEnv("ADMIN_PASSWORD", "password"),
+		PresetsFile:    getEnv("PRESETS_FILE", ""),
+		ProcessTimeout: getEnvDuration("PROCESS_TIMEOUT", 30*time.Second),
+		JobWorkers:     getEnvInt("JOB_WORKERS", 2),
+		JobQueueSize:   getEnvInt("JOB_QUEUE_SIZE", 16),
+		JobTimeout:     getEnvDuration("JOB_TIMEOUT", 10*time.Minute),
+		JobResultTTL:   getEnvDuration("JOB_RESULT_TTL", time.Hour),
+		JobResultMB:    getEnvInt("JOB_RESULT_MAX_MB", 512),
+		BatchMaxFiles:  getEnvInt("BATCH_MAX_FILES", 20),
+		OutputSuffix:   getEnv("OUTPUT_SUFFIX", "_antimg"),
+		MaxMegapixels:  getEnvInt("MAX_MEGAPIXELS", 50),
+		OversizeMode:   getEnv("OVERSIZE_MODE", "reject"),
+		AllowedFormats: getEnvFormats("ALLOWED_FORMATS", "jpeg,png,bmp,webp"),
+	}
+
+	if AppConfig.OversizeMode != "reject" && AppConfig.OversizeMode != "downscale" {
+		panic("OVERSIZE_MODE must be reject or downscale")
+	}
+	AppConfig.MaxDecodeMegapixels = getEnvInt("MAX_DECODE_MEGAPIXELS", 2*AppConfig.MaxMegapixels)
+	if AppConfig.MaxDecodeMegapixels < AppConfig.MaxMegapixels {
+		panic("MAX_DECODE_MEGAPIXELS must not be less than MAX_MEGAPIXELS")
 	}
 }
 
@@ -37,3 +81,48 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvFormats 读取逗号分隔的图片格式列表（如 jpeg,png,webp），包含未知格式时拒绝启动
+func getEnvFormats(key, defaultValue string) []string {
+	var formats []string
+	for _, name := range strings.Split(getEnv(key, defaultValue), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		format, err := codec.ParseFormat(name)
+		if err != nil {
+			panic(key + " only supports jpeg, png, bmp, webp, tiff")
+		}
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		panic(key + " must list at least one format")
+	}
+	return formats
+}
+
+// getEnvInt 读取正整数配置，格式错误时拒绝启动
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		panic(key + " must be a positive integer")
+	}
+	return n
+}
+
+// getEnvDuration 读取时长配置（如 30s、2m），格式错误时拒绝启动
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		panic(key + " must be a positive duration, e.g. 30s or 2m")
+	}
+	return d
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Neurocoda/Antimg/codec"
+	"github.com/Neurocoda/Antimg/config"
+	"github.com/Neurocoda/Antimg/metrics"
+	"github.com/Neurocoda/Antimg/services"
+	"github.com/Neurocoda/Antimg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// batchInput 批处理中的单个输入文件
+type batchInput struct {
+	name string
+	open func() (io.ReadCloser, error)
+	err  error // 验证失败原因，非空时跳过处理
+}
+
+// batchEntry 清单中单个文件的处理结果
+type batchEntry struct {
+	Name        string          `json:"name"`
+	Output      string          `json:"output,omitempty"`
+	Status      string          `json:"status"` // ok 或 error
+	Seed        int64           `json:"seed,omitempty"`
+	Metadata    string          `json:"metadata,omitempty"`     // 实际生效的元数据策略
+	ICC         string          `json:"icc,omitempty"`          // ICC 配置文件的处理方式
+	Metrics     *metrics.Result `json:"metrics,omitempty"`      // 处理前后的质量指标
+	AttackLevel *float64        `json:"attack_level,omitempty"` // 实际使用的攻击强度
+	Error       string          `json:"error,omitempty"`
+	ErrorCode   string          `json:"error_code,omitempty"` // 机器可读的错误码，如 image_too_large
+}
+
+// batchManifest 批处理清单，作为 manifest.json 写入结果压缩包
+type batchManifest struct {
+	Total     int          `json:"total"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Files     []batchEntry `json:"files"`
+}
+
+// API: 批量攻击水印，接受多个 image 文件或一个 archive ZIP 压缩包，返回结果ZIP
+func (h *ImageHandler) AttackBatch(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "文件上传失败")
+		return
+	}
+
+	opts, err := parseProcessOptions(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	inputs, err := collectBatchInputs(form)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	maxFiles := config.AppConfig.BatchMaxFiles
+	if len(inputs) > maxFiles {
+		utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("文件数量超过限制，单次最多处理%d个文件", maxFiles))
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/zip")
+	c.Writer.Header().Set("Content-Disposition", "attachment; filename=\"processed_images.zip\"")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	defer zw.Close()
+
+	manifest := batchManifest{Total: len(inputs)}
+	usedNames := make(map[string]bool)
+	for _, input := range inputs {
+		entry := h.processBatchInput(c, zw, input, opts, usedNames)
+		if entry.Status == "ok" {
+			manifest.Succeeded++
+		} else {
+			manifest.Failed++
+		}
+		manifest.Files = append(manifest.Files, entry)
+
+		// 客户端已断开，停止处理剩余文件
+		if c.Request.Context().Err() != nil {
+			return
+		}
+	}
+
+	w, err := zw.Create("manifest.json")
+	if err != nil {
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(manifest)
+}
+
+// processBatchInput 处理单个文件并写入压缩包
+func (h *ImageHandler) processBatchInput(c *gin.Context, zw *zip.Writer, input batchInput, opts services.ProcessOptions, usedNames map[string]bool) batchEntry {
+	entry := batchEntry{Name: input.name, Status: "error"}
+	if input.err != nil {
+		entry.Error = input.err.Error()
+		return entry
+	}
+
+	src, err := input.open()
+	if err != nil {
+		entry.Error = "文件打开错误"
+		return entry
+	}
+	defer src.Close()
+
+	result, err := h.imageService.ProcessImage(c.Request.Context(), src, opts)
+	if err != nil {
+		var tooLarge *services.ImageTooLargeError
+		if errors.As(err, &tooLarge) {
+			entry.Error, entry.ErrorCode = err.Error(), errCodeImageTooLarge
+			return entry
+		}
+		entry.Error = "图片处理失败: " + err.Error()
+		return entry
+	}
+	entry.Seed = result.Seed
+
+	// 先编码到缓冲区，编码失败时不在压缩包中留下空条目
+	var buf bytes.Buffer
+	if err := utils.EncodeImage(&buf, result.Format, result.Image, result.Output); err != nil {
+		entry.Error = "图片编码失败: " + err.Error()
+		return entry
+	}
+
+	output := uniqueName(utils.ImageFilename(input.name, result.Output.OutputFormat(result.Format)), usedNames)
+	w, err := zw.Create(output)
+	if err != nil {
+		entry.Error = "写入压缩包失败"
+		return entry
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		entry.Error = "写入压缩包失败"
+		return entry
+	}
+
+	entry.Output = output
+	entry.Metadata = string(codec.EffectivePolicy(result.Output.OutputFormat(result.Format), result.Output.MetadataPolicy))
+	entry.ICC = string(result.Output.ICCMode)
+	entry.Metrics = result.Metrics
+	entry.AttackLevel = &result.AttackLevel
+	entry.Status = "ok"
+	return entry
+}
+
+// collectBatchInputs 从表单中收集待处理文件
+func collectBatchInputs(form *multipart.Form) ([]batchInput, error) {
+	archives := form.File["archive"]
+	images := form.File["image"]
+
+	switch {
+	case len(archives) > 0 && len(images) > 0:
+		return nil, errors.New("image 与 archive 不能同时上传")
+	case len(archives) > 1:
+		return nil, errors.New("每次只能上传一个ZIP压缩包")
+	case len(archives) == 1:
+		return zipInputs(archives[0])
+	case len(images) == 0:
+		return nil, errors.New("未上传任何图片")
+	}
+
+	inputs := make([]batchInput, 0, len(images))
+	for _, header := range images {
+		header := header
+		inputs = append(inputs, batchInput{
+			name: header.Filename,
+			open: func() (io.ReadCloser, error) { return header.Open() },
+			err:  validateImageFile(header),
+		})
+	}
+	return inputs, nil
+}
+
+// zipInputs 读取ZIP压缩包中的图片文件，忽略目录和系统生成的隐藏文件
+func zipInputs(header *multipart.FileHeader) ([]batchInput, error) {
+	if header.Size > maxFileSize {
+		return nil, errors.New("压缩包大小超过限制，最大支持100MB")
+	}
+
+	src, err := header.Open()
+	if err != nil {
+		return nil, errors.New("压缩包打开错误")
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, errors.New("压缩包读取错误")
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("无效的ZIP压缩包")
+	}
+
+	var inputs []batchInput
+	for _, file := range reader.File {
+		file := file
+		if file.FileInfo().IsDir() || strings.HasPrefix(file.Name, "__MACOSX/") || strings.HasPrefix(path.Base(file.Name), ".") {
+			continue
+		}
+		inputs = append(inputs, batchInput{
+			name: file.Name,
+			open: func() (io.ReadCloser, error) { return openZipEntry(file) },
+			err: validateImage(file.Name, int64(file.UncompressedSize64), func() (io.ReadCloser, error) {
+				return openZipEntry(file)
+			}),
+		})
+	}
+
+	if len(inputs) == 0 {
+		return nil, errors.New("压缩包中没有图片文件")
+	}
+	return inputs, nil
+}
+
+// openZipEntry 打开压缩包条目，限制实际解压大小以防止压缩炸弹
+func openZipEntry(file *zip.File) (io.ReadCloser, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, maxFileSize), rc}, nil
+}
+
+// uniqueName 为重名的输出文件追加序号
+func uniqueName(name string, used map[string]bool) string {
+	candidate := name
+	ext := path.Ext(name)
+	for i := 1; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
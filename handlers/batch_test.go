@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// 单个文件编码失败时记录到清单，不影响其他文件，也不在压缩包中留下空条目
+func TestAttackBatchEncodeFailure(t *testing.T) {
+	setupTestConfig(t)
+	h := NewImageHandler()
+
+	// WebP 最大宽度为16383，过宽的图片处理成功但编码失败
+	w := serveForm(t, h.AttackBatch, []formFile{
+		{"image", "ok.png", testPNG(t, 32, 24)},
+		{"image", "wide.png", testPNG(t, 16400, 2)},
+		{"image", "ok2.png", testPNG(t, 32, 24)},
+	}, map[string]string{"pipeline": "noise", "outputFormat": "webp", "metrics": "false", "seed": "1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var manifest batchManifest
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.UncompressedSize64 == 0 {
+			t.Errorf("压缩包中有空条目 %s", f.Name)
+		}
+		if f.Name == "manifest.json" {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+				t.Fatal(err)
+			}
+			rc.Close()
+		}
+	}
+	if want := []string{"ok_antimg.webp", "ok2_antimg.webp", "manifest.json"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("压缩包条目 %v, 期望 %v", names, want)
+	}
+
+	if manifest.Total != 3 || manifest.Succeeded != 2 || manifest.Failed != 1 {
+		t.Fatalf("清单统计: %+v", manifest)
+	}
+	failed := manifest.Files[1]
+	if failed.Name != "wide.png" || failed.Status != "error" || failed.Output != "" || !strings.HasPrefix(failed.Error, "图片编码失败") {
+		t.Errorf("失败条目: %+v", failed)
+	}
+}
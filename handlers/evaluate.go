@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Neurocoda/Antimg/services"
+	"github.com/Neurocoda/Antimg/utils"
+	"github.com/Neurocoda/Antimg/watermark"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPayloadBytes 文本载荷的最大字节数
+const maxPayloadBytes = 32
+
+// API: 评估攻击对参考水印的破坏效果
+// 先嵌入参考水印，再按攻击参数处理，返回每种水印的误码率以及是否仍可检测
+func (h *ImageHandler) Evaluate(c *gin.Context) {
+	file, err := c.FormFile("image")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "文件上传失败")
+		return
+	}
+	if err := validateImageFile(file); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	process, err := parseProcessOptions(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts, err := parseEvaluateOptions(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.Process = process
+
+	src, err := file.Open()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "文件打开错误")
+		return
+	}
+	defer src.Close()
+
+	result, err := h.imageService.Evaluate(c.Request.Context(), src, opts)
+	if err != nil {
+		// 容量不足由图片尺寸和载荷长度决定，属于请求参数问题
+		var tooSmall *watermark.CapacityError
+		if errors.As(err, &tooSmall) {
+			utils.ErrorResponseWithCode(c, http.StatusBadRequest, errCodeImageTooSmall, err.Error())
+			return
+		}
+		processErrorResponse(c, err)
+		return
+	}
+	utils.SuccessResponse(c, result)
+}
+
+// parseEvaluateOptions 解析水印算法列表、文本载荷和密钥
+func parseEvaluateOptions(c *gin.Context) (services.EvaluateOptions, error) {
+	var opts services.EvaluateOptions
+
+	if list := c.PostForm("watermark"); list != "" {
+		for _, name := range strings.Split(list, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, ok := watermark.Get(name); !ok {
+				return opts, errors.New("未知的水印算法: " + name + "，仅支持 " + strings.Join(watermark.Names(), "、"))
+			}
+			opts.Schemes = append(opts.Schemes, name)
+		}
+	}
+
+	if keyStr := c.PostForm("key"); keyStr != "" {
+		key, err := strconv.ParseInt(keyStr, 10, 64)
+		if err != nil {
+			return opts, errors.New("水印密钥必须是整数")
+		}
+		opts.Key = &key
+	}
+
+	payload := c.PostForm("payload")
+	if len(payload) > maxPayloadBytes {
+		return opts, errors.New("水印载荷最多32字节")
+	}
+	opts.Payload = watermark.BitsFromBytes([]byte(payload))
+	return opts, nil
+}
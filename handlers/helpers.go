@@ -2,11 +2,20 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"mime/multipart"
+	"net/http"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/Neurocoda/Antimg/codec"
+	"github.com/Neurocoda/Antimg/config"
+	"github.com/Neurocoda/Antimg/services"
+	"github.com/Neurocoda/Antimg/utils"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -29,41 +38,256 @@ func parseAttackLevel(c *gin.Context) (float64, error) {
 	return level, nil
 }
 
+// parseProcessOptions 解析攻击强度、预设、处理流程、随机种子、质量目标、质量指标开关和输出参数
+// 显式的 attackLevel 优先于预设的默认强度；preset 与 pipeline 不能同时使用
+func parseProcessOptions(c *gin.Context) (services.ProcessOptions, error) {
+	var opts services.ProcessOptions
+
+	attackLevel, err := parseAttackLevel(c)
+	if err != nil {
+		return opts, errors.New("攻击强度参数无效: " + err.Error())
+	}
+	opts.AttackLevel = attackLevel
+
+	presetName := c.PostForm("preset")
+	pipelineSpec := c.PostForm("pipeline")
+	if presetName != "" && pipelineSpec != "" {
+		return opts, errors.New("preset 与 pipeline 参数不能同时使用")
+	}
+
+	if presetName != "" {
+		preset, exists := services.GetPreset(presetName)
+		if !exists {
+			return opts, errors.New("未知的预设: " + presetName)
+		}
+		opts.Pipeline = preset.Stages
+		if c.PostForm("attackLevel") == "" && preset.Level != nil {
+			opts.AttackLevel = *preset.Level
+		}
+	}
+
+	if pipelineSpec != "" {
+		pipeline, err := services.ParsePipeline(pipelineSpec)
+		if err != nil {
+			return opts, errors.New("处理流程参数无效: " + err.Error())
+		}
+		opts.Pipeline = pipeline
+	}
+
+	if seedStr := c.PostForm("seed"); seedStr != "" {
+		seed, err := strconv.ParseInt(seedStr, 10, 64)
+		if err != nil {
+			return opts, errors.New("随机种子必须是整数")
+		}
+		opts.Seed = &seed
+	}
+
+	target, err := parseQualityTarget(c)
+	if err != nil {
+		return opts, err
+	}
+	if target != nil && c.PostForm("attackLevel") != "" {
+		return opts, errors.New("attackLevel 与 targetSSIM、targetPSNR 不能同时使用")
+	}
+	opts.Target = target
+
+	if metricsStr := c.PostForm("metrics"); metricsStr != "" {
+		enabled, err := strconv.ParseBool(metricsStr)
+		if err != nil {
+			return opts, errors.New("metrics 参数必须是 true 或 false")
+		}
+		opts.SkipMetrics = !enabled
+	}
+
+	output, err := parseOutputOptions(c)
+	if err != nil {
+		return opts, err
+	}
+	opts.Output = output
+
+	return opts, nil
+}
+
+// parseQualityTarget 解析自适应攻击的质量目标 targetSSIM 或 targetPSNR，均未指定时返回 nil
+func parseQualityTarget(c *gin.Context) (*services.QualityTarget, error) {
+	ssimStr, psnrStr := c.PostForm("targetSSIM"), c.PostForm("targetPSNR")
+	if ssimStr != "" && psnrStr != "" {
+		return nil, errors.New("targetSSIM 与 targetPSNR 不能同时使用")
+	}
+
+	metric, valueStr := services.MetricSSIM, ssimStr
+	if psnrStr != "" {
+		metric, valueStr = services.MetricPSNR, psnrStr
+	}
+	if valueStr == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		return nil, errors.New("质量目标必须是数字")
+	}
+	return services.ParseQualityTarget(string(metric), value)
+}
+
+// setResultHeaders 在响应头中返回随机种子、攻击强度和质量指标
+func setResultHeaders(c *gin.Context, result *services.ProcessResult) {
+	// 返回实际使用的随机种子和攻击强度，便于复现处理结果
+	c.Header("X-Antimg-Seed", strconv.FormatInt(result.Seed, 10))
+	c.Header("X-Antimg-Attack-Level", strconv.FormatFloat(result.AttackLevel, 'f', -1, 64))
+	if result.TargetMet != nil {
+		c.Header("X-Antimg-Target-Met", strconv.FormatBool(*result.TargetMet))
+	}
+	if m := result.Metrics; m != nil {
+		c.Header("X-Antimg-PSNR", strconv.FormatFloat(m.PSNR, 'f', -1, 64))
+		c.Header("X-Antimg-SSIM", strconv.FormatFloat(m.SSIM, 'f', -1, 64))
+		c.Header("X-Antimg-MS-SSIM", strconv.FormatFloat(m.MSSSIM, 'f', -1, 64))
+	}
+}
+
+// parseOutputOptions 解析输出格式和编码参数
+func parseOutputOptions(c *gin.Context) (codec.Options, error) {
+	var opts codec.Options
+
+	if format := c.PostForm("outputFormat"); format != "" {
+		parsed, err := codec.ParseFormat(format)
+		if err != nil {
+			return opts, err
+		}
+		opts.Format = parsed
+	}
+
+	if qualityStr := c.PostForm("quality"); qualityStr != "" {
+		quality, err := strconv.Atoi(qualityStr)
+		if err != nil || quality < 1 || quality > 100 {
+			return opts, errors.New("输出质量必须是1-100之间的整数")
+		}
+		opts.Quality = quality
+	}
+
+	if progressiveStr := c.PostForm("progressive"); progressiveStr != "" {
+		progressive, err := strconv.ParseBool(progressiveStr)
+		if err != nil {
+			return opts, errors.New("progressive 参数必须是 true 或 false")
+		}
+		opts.Progressive = progressive
+	}
+
+	subsampling, err := codec.ParseSubsampling(c.PostForm("chromaSubsampling"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Subsampling = subsampling
+
+	compression, err := codec.ParsePNGCompression(c.PostForm("pngCompression"))
+	if err != nil {
+		return opts, err
+	}
+	opts.PNGCompression = compression
+
+	policy, err := codec.ParseMetadataPolicy(c.PostForm("metadata"))
+	if err != nil {
+		return opts, err
+	}
+	opts.MetadataPolicy = policy
+
+	iccMode, err := codec.ParseICCMode(c.PostForm("iccMode"))
+	if err != nil {
+		return opts, err
+	}
+	opts.ICCMode = iccMode
+
+	return opts, nil
+}
+
+// parseDisposition 解析结果的返回方式: attachment（默认）或 inline，可通过表单或查询参数传入
+func parseDisposition(c *gin.Context) (string, error) {
+	disposition := c.PostForm("disposition")
+	if disposition == "" {
+		disposition = c.Query("disposition")
+	}
+
+	switch strings.ToLower(disposition) {
+	case "", "attachment":
+		return "attachment", nil
+	case "inline":
+		return "inline", nil
+	}
+	return "", errors.New("disposition 参数仅支持 inline 或 attachment")
+}
+
+// errCodeImageTooLarge 图片像素数超过限制的错误码
+const errCodeImageTooLarge = "image_too_large"
+
+// errCodeImageTooSmall 图片太小，无法嵌入参考水印的错误码
+const errCodeImageTooSmall = "image_too_small"
+
+// pixelLimit 由配置生成输入图片的像素数限制
+func pixelLimit() services.PixelLimit {
+	cfg := config.AppConfig
+	return services.PixelLimit{
+		MaxPixels:       cfg.MaxMegapixels * 1000000,
+		Downscale:       cfg.OversizeMode == "downscale",
+		MaxDecodePixels: cfg.MaxDecodeMegapixels * 1000000,
+	}
+}
+
+// processErrorResponse 返回图片处理失败的错误响应，尺寸超限返回 413 和错误码
+func processErrorResponse(c *gin.Context, err error) {
+	var tooLarge *services.ImageTooLargeError
+	if errors.As(err, &tooLarge) {
+		utils.ErrorResponseWithCode(c, http.StatusRequestEntityTooLarge, errCodeImageTooLarge, err.Error())
+		return
+	}
+	utils.ErrorResponse(c, http.StatusInternalServerError, "图片处理失败: "+err.Error())
+}
+
+// maxFileSize 单个图片文件大小上限 (100MB)
+const maxFileSize = 100 << 20
+
 // validateImageFile 验证上传的图片文件
 func validateImageFile(header *multipart.FileHeader) error {
+	return validateImage(header.Filename, header.Size, func() (io.ReadCloser, error) {
+		return header.Open()
+	})
+}
+
+// validateImage 验证文件大小，并按文件头的魔数识别真实格式，
+// 不信任客户端提供的扩展名和 Content-Type
+func validateImage(filename string, size int64, open func() (io.ReadCloser, error)) error {
 	// 检查文件大小 (最大100MB)
-	const maxFileSize = 100 << 20 // 100MB
-	if header.Size > maxFileSize {
+	if size > maxFileSize {
 		return errors.New("文件大小超过限制，最大支持100MB")
 	}
 
-	// 检查文件扩展名
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	allowedExts := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".bmp":  true,
-		".webp": true,
+	src, err := open()
+	if err != nil {
+		return errors.New("文件打开错误")
 	}
+	defer src.Close()
 
-	if !allowedExts[ext] {
-		return errors.New("不支持的图片格式，仅支持: jpg, jpeg, png, bmp, webp")
-	}
+	head := make([]byte, codec.SniffLen)
+	n, _ := io.ReadFull(src, head)
+	return checkImageFormat(filename, head[:n])
+}
 
-	// 检查MIME类型
-	contentType := header.Header.Get("Content-Type")
-	allowedMimes := map[string]bool{
-		"image/jpeg": true,
-		"image/jpg":  true,
-		"image/png":  true,
-		"image/bmp":  true,
-		"image/webp": true,
-	}
+// checkImageFormat 检查文件内容的格式是否允许上传，以及扩展名是否与内容一致
+func checkImageFormat(filename string, head []byte) error {
+	allowed := config.AppConfig.AllowedFormats
 
-	if contentType != "" && !allowedMimes[contentType] {
-		return errors.New("无效的图片MIME类型")
+	format := codec.Sniff(head)
+	if format == "" {
+		return fmt.Errorf("无法识别的文件内容，仅支持: %s", strings.Join(allowed, ", "))
+	}
+	if !slices.Contains(allowed, format) {
+		return fmt.Errorf("不支持的图片格式 %s，仅支持: %s", format, strings.Join(allowed, ", "))
 	}
 
+	// 扩展名可以省略，但给出时必须与实际内容一致
+	if ext := filepath.Ext(filename); ext != "" {
+		if parsed, err := codec.ParseFormat(ext); err != nil || parsed != format {
+			return fmt.Errorf("文件扩展名 %s 与实际内容（%s）不一致", ext, format)
+		}
+	}
 	return nil
 }
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/Neurocoda/Antimg/config"
 	"github.com/Neurocoda/Antimg/models"
 	"github.com/Neurocoda/Antimg/services"
 	"github.com/Neurocoda/Antimg/utils"
@@ -17,7 +19,7 @@ type ImageHandler struct {
 
 func NewImageHandler() *ImageHandler {
 	return &ImageHandler{
-		imageService: services.NewImageService(),
+		imageService: services.NewImageService(config.AppConfig.ProcessTimeout, pixelLimit()),
 	}
 }
 
@@ -42,19 +44,102 @@ func (h *ImageHandler) AttackWatermark(c *gin.Context) {
 	}
 	defer src.Close()
 
-	attackLevel, err := parseAttackLevel(c)
+	opts, err := parseProcessOptions(c)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "攻击强度参数无效: "+err.Error())
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	disposition, err := parseDisposition(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.imageService.ProcessImage(c.Request.Context(), src, opts)
+	if err != nil {
+		processErrorResponse(c, err)
+		return
+	}
+
+	setResultHeaders(c, result)
+	utils.SendImageResponse(c, file.Filename, disposition, result.Format, result.Image, result.Output)
+}
+
+// API: 分析攻击造成的画面损伤，以 JSON 返回质量指标
+// 同时上传 processed 时直接比较 image 与 processed，否则按攻击参数处理 image 后比较
+func (h *ImageHandler) Analyze(c *gin.Context) {
+	file, err := c.FormFile("image")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "文件上传失败")
+		return
+	}
+	if err := validateImageFile(file); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "文件打开错误")
+		return
+	}
+	defer src.Close()
+
+	if processedFile, err := c.FormFile("processed"); err == nil {
+		if err := validateImageFile(processedFile); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "processed: "+err.Error())
+			return
+		}
+		processed, err := processedFile.Open()
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "文件打开错误")
+			return
+		}
+		defer processed.Close()
+
+		m, err := h.imageService.CompareImages(c.Request.Context(), src, processed)
+		if err != nil {
+			processErrorResponse(c, err)
+			return
+		}
+		utils.SuccessResponse(c, gin.H{"metrics": m})
 		return
 	}
 
-	processedImg, format, err := h.imageService.ProcessImage(src, attackLevel)
+	opts, err := parseProcessOptions(c)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "图片处理失败: "+err.Error())
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.SkipMetrics = false
+
+	result, err := h.imageService.ProcessImage(c.Request.Context(), src, opts)
+	if err != nil {
+		processErrorResponse(c, err)
 		return
 	}
 
-	utils.SendImageResponse(c, format, processedImg)
+	bounds := result.Image.Bounds()
+	data := gin.H{
+		"seed":         result.Seed,
+		"attack_level": result.AttackLevel,
+		"width":        bounds.Dx(),
+		"height":       bounds.Dy(),
+		"metrics":      result.Metrics,
+	}
+	if result.TargetMet != nil {
+		data["target_met"] = *result.TargetMet
+	}
+	utils.SuccessResponse(c, data)
+}
+
+// API: 列出可用的攻击预设
+func (h *ImageHandler) ListPresets(c *gin.Context) {
+	utils.SuccessResponse(c, gin.H{
+		"presets": services.ListPresets(),
+		"stages":  services.StageNames(),
+	})
 }
 
 // Web: 图像处理页面
@@ -127,17 +212,24 @@ func (h *ImageHandler) WebProcessImage(c *gin.Context) {
 		}
 	}
 
-	processedImg, format, err := h.imageService.ProcessImage(src, attackLevel)
+	result, err := h.imageService.ProcessImage(c.Request.Context(), src, services.ProcessOptions{
+		AttackLevel: attackLevel,
+	})
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "base.html", gin.H{
+		status, message := http.StatusInternalServerError, "图片处理失败: "+err.Error()
+		var tooLarge *services.ImageTooLargeError
+		if errors.As(err, &tooLarge) {
+			status, message = http.StatusRequestEntityTooLarge, err.Error()
+		}
+		c.HTML(status, "base.html", gin.H{
 			"title":    "图像处理工作台 - Antimg",
 			"username": c.GetString("username"),
-			"error":    "图片处理失败: " + err.Error(),
+			"error":    message,
 			"page":     "process",
 		})
 		return
 	}
 
 	// 直接返回处理后的图片，保持原格式
-	utils.SendImageResponse(c, format, processedImg)
+	utils.SendImageResponse(c, file.Filename, "attachment", result.Format, result.Image, result.Output)
 }
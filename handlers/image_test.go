@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Neurocoda/Antimg/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupTestConfig(t *testing.T) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{
+		ProcessTimeout:      30 * time.Second,
+		BatchMaxFiles:       20,
+		OutputSuffix:        "_antimg",
+		MaxMegapixels:       50,
+		OversizeMode:        "reject",
+		MaxDecodeMegapixels: 100,
+		AllowedFormats:      []string{"jpeg", "png", "bmp", "webp"},
+	}
+}
+
+// testPNG 生成带渐变的 PNG 图片
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 4), uint8(y * 4), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// formFile 描述 multipart 表单中的一个文件字段
+type formFile struct {
+	field, name string
+	data        []byte
+}
+
+// serveForm 以 multipart 表单调用 handler，返回响应记录
+func serveForm(t *testing.T, handler gin.HandlerFunc, files []formFile, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, f := range files {
+		fw, err := mw.CreateFormFile(f.field, f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(f.data)
+	}
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+
+	w := httptest.NewRecorder()
+	_, engine := gin.CreateTestContext(w)
+	engine.POST("/", handler)
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestAttackWatermarkHeaders(t *testing.T) {
+	setupTestConfig(t)
+	h := NewImageHandler()
+	src := testPNG(t, 64, 48)
+
+	w := serveForm(t, h.AttackWatermark, []formFile{{"image", "a.png", src}},
+		map[string]string{"seed": "42", "attackLevel": "0.3"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Antimg-Seed"); got != "42" {
+		t.Errorf("X-Antimg-Seed = %q, 期望 42", got)
+	}
+	if got := w.Header().Get("X-Antimg-Attack-Level"); got != "0.3" {
+		t.Errorf("X-Antimg-Attack-Level = %q, 期望 0.3", got)
+	}
+	if got := w.Header().Get("X-Antimg-Target-Met"); got != "" {
+		t.Errorf("未指定质量目标时不应返回 X-Antimg-Target-Met: %q", got)
+	}
+	for _, name := range []string{"X-Antimg-PSNR", "X-Antimg-SSIM", "X-Antimg-MS-SSIM"} {
+		v, err := strconv.ParseFloat(w.Header().Get(name), 64)
+		if err != nil {
+			t.Errorf("%s 无效: %v", name, err)
+			continue
+		}
+		// 攻击后图片有损伤但指标仍为正数
+		if v <= 0 || (name != "X-Antimg-PSNR" && v >= 1) {
+			t.Errorf("%s = %v 超出合理范围", name, v)
+		}
+	}
+	if _, err := png.Decode(bytes.NewReader(w.Body.Bytes())); err != nil {
+		t.Errorf("响应不是有效的 PNG: %v", err)
+	}
+
+	// 关闭质量指标时不返回指标响应头
+	w = serveForm(t, h.AttackWatermark, []formFile{{"image", "a.png", src}},
+		map[string]string{"seed": "42", "metrics": "false"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Antimg-PSNR"); got != "" {
+		t.Errorf("metrics=false 时 X-Antimg-PSNR = %q", got)
+	}
+}
+
+// analyzeResponse /api/analyze 的响应结构
+type analyzeResponse struct {
+	Code int `json:"code"`
+	Data struct {
+		Seed        *int64   `json:"seed"`
+		AttackLevel *float64 `json:"attack_level"`
+		Width       int      `json:"width"`
+		Height      int      `json:"height"`
+		Metrics     *struct {
+			PSNR   float64 `json:"psnr"`
+			SSIM   float64 `json:"ssim"`
+			MSSSIM float64 `json:"ms_ssim"`
+		} `json:"metrics"`
+	} `json:"data"`
+}
+
+func TestAnalyze(t *testing.T) {
+	setupTestConfig(t)
+	h := NewImageHandler()
+	src := testPNG(t, 64, 48)
+
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) analyzeResponse {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		var resp analyzeResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Data.Metrics == nil {
+			t.Fatalf("缺少 metrics: %s", w.Body.String())
+		}
+		return resp
+	}
+
+	t.Run("compare", func(t *testing.T) {
+		w := serveForm(t, h.Analyze, []formFile{
+			{"image", "a.png", src},
+			{"processed", "b.png", src},
+		}, nil)
+		resp := decode(t, w)
+		m := resp.Data.Metrics
+		if m.PSNR != 100 || m.SSIM != 1 || m.MSSSIM != 1 {
+			t.Errorf("相同图片的指标: %+v", *m)
+		}
+		// 直接比较时不处理图片，不返回种子和攻击强度
+		if resp.Data.Seed != nil || resp.Data.AttackLevel != nil {
+			t.Errorf("直接比较时不应返回 seed/attack_level: %s", w.Body.String())
+		}
+	})
+
+	t.Run("process", func(t *testing.T) {
+		// metrics=false 在分析接口中被忽略
+		w := serveForm(t, h.Analyze, []formFile{{"image", "a.png", src}},
+			map[string]string{"seed": "7", "attackLevel": "0.4", "metrics": "false"})
+		resp := decode(t, w)
+		if resp.Data.Seed == nil || *resp.Data.Seed != 7 {
+			t.Errorf("seed = %v, 期望 7", resp.Data.Seed)
+		}
+		if resp.Data.AttackLevel == nil || *resp.Data.AttackLevel != 0.4 {
+			t.Errorf("attack_level = %v, 期望 0.4", resp.Data.AttackLevel)
+		}
+		if resp.Data.Width <= 0 || resp.Data.Height <= 0 {
+			t.Errorf("尺寸无效: %dx%d", resp.Data.Width, resp.Data.Height)
+		}
+		m := resp.Data.Metrics
+		if m.PSNR <= 0 || m.PSNR >= 100 || m.SSIM <= 0 || m.SSIM >= 1 || m.MSSSIM <= 0 || m.MSSSIM >= 1 {
+			t.Errorf("攻击后的指标超出合理范围: %+v", *m)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Neurocoda/Antimg/config"
+	"github.com/Neurocoda/Antimg/services"
+	"github.com/Neurocoda/Antimg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	manager *services.JobManager
+}
+
+func NewJobHandler() *JobHandler {
+	cfg := config.AppConfig
+	return &JobHandler{
+		manager: services.NewJobManager(
+			services.NewImageService(cfg.JobTimeout, pixelLimit()),
+			cfg.JobWorkers,
+			cfg.JobQueueSize,
+			cfg.JobResultTTL,
+			int64(cfg.JobResultMB)<<20,
+		),
+	}
+}
+
+// API: 提交异步处理任务
+func (h *JobHandler) Submit(c *gin.Context) {
+	file, err := c.FormFile("image")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "文件上传失败")
+		return
+	}
+
+	// 验证文件类型
+	if err := validateImageFile(file); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts, err := parseProcessOptions(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "文件打开错误")
+		return
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "文件读取错误")
+		return
+	}
+
+	info, err := h.manager.Submit(c.GetString("username"), file.Filename, data, opts)
+	if err != nil {
+		if errors.Is(err, services.ErrJobQueueFull) {
+			utils.ErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		var tooLarge *services.ImageTooLargeError
+		if errors.As(err, &tooLarge) {
+			utils.ErrorResponseWithCode(c, http.StatusRequestEntityTooLarge, errCodeImageTooLarge, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "任务提交失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, jobResponse(info))
+}
+
+// API: 查询任务状态和进度
+func (h *JobHandler) Status(c *gin.Context) {
+	info, ok := h.ownedJob(c)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, jobResponse(info))
+}
+
+// API: 下载任务处理结果
+func (h *JobHandler) Result(c *gin.Context) {
+	info, ok := h.ownedJob(c)
+	if !ok {
+		return
+	}
+
+	disposition, err := parseDisposition(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.manager.Result(info.ID)
+	if err != nil {
+		if errors.Is(err, services.ErrJobNotReady) {
+			utils.ErrorResponse(c, http.StatusConflict, "任务尚未完成，当前状态: "+string(info.Status))
+			return
+		}
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	setResultHeaders(c, &result.ProcessResult)
+	utils.SendEncodedImage(c, info.Filename, disposition, result.Format, result.Data, result.Output)
+}
+
+// API: 取消任务（已结束的任务会被删除）
+func (h *JobHandler) Cancel(c *gin.Context) {
+	info, ok := h.ownedJob(c)
+	if !ok {
+		return
+	}
+
+	info, err := h.manager.Cancel(info.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, jobResponse(info))
+}
+
+// ownedJob 获取当前用户的任务，任务不存在或属于其他用户时返回404
+func (h *JobHandler) ownedJob(c *gin.Context) (services.JobInfo, bool) {
+	info, err := h.manager.Get(c.Param("id"))
+	if err != nil || info.Owner != c.GetString("username") {
+		utils.ErrorResponse(c, http.StatusNotFound, services.ErrJobNotFound.Error())
+		return services.JobInfo{}, false
+	}
+	return info, true
+}
+
+// jobResponse 任务信息附带状态和结果的访问地址
+func jobResponse(info services.JobInfo) gin.H {
+	return gin.H{
+		"job":        info,
+		"status_url": "/api/jobs/" + info.ID,
+		"result_url": "/api/jobs/" + info.ID + "/result",
+	}
+}
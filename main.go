@@ -2,9 +2,12 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/Neurocoda/Antimg/config"
+	"github.com/Neurocoda/Antimg/models"
 	"github.com/Neurocoda/Antimg/routes"
+	"github.com/Neurocoda/Antimg/services"
 )
 
 // 构建时注入的版本信息
@@ -18,8 +21,23 @@ func main() {
 	// 打印版本信息
 	log.Printf("🚀 Antimg v%s (built at %s, revision %s)", Version, BuildTime, Revision)
 
+	// 子命令：bench 在本地图片目录上运行攻击基准测试，不启动服务器
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBench(os.Args[2:]))
+	}
+
 	// 初始化配置
 	config.Init()
+	models.Init()
+
+	// 加载自定义攻击预设
+	if config.AppConfig.PresetsFile != "" {
+		count, err := services.LoadPresetFile(config.AppConfig.PresetsFile)
+		if err != nil {
+			log.Fatal("❌ 加载预设配置失败:", err)
+		}
+		log.Printf("🎛️ 已加载 %d 个自定义预设", count)
+	}
 
 	// 设置路由
 	r := routes.SetupRoutes()
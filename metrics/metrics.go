@@ -0,0 +1,107 @@
+// Package metrics 计算处理前后图片之间的质量指标（PSNR、SSIM、MS-SSIM），
+// 用于衡量攻击对画面造成的损伤
+package metrics
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// PSNRIdentical 两张图片完全相同时记录的 PSNR（dB），避免出现无穷大
+const PSNRIdentical = 100
+
+// Result 质量指标，数值越高表示与原图越接近
+type Result struct {
+	PSNR   float64 `json:"psnr"`    // 峰值信噪比（dB），基于 RGB 三通道
+	SSIM   float64 `json:"ssim"`    // 结构相似度，基于亮度通道
+	MSSSIM float64 `json:"ms_ssim"` // 多尺度结构相似度，基于亮度通道
+}
+
+// Compare 计算 processed 相对 reference 的质量指标
+// 两者尺寸不同（如旋转扩大了画布）时先将 processed 缩放到 reference 的尺寸；
+// 像素按透明度预乘后比较，完全透明区域的颜色差异不计入；
+// 任一图片面积为0时无法比较，各项指标均为0
+func Compare(reference, processed image.Image) Result {
+	if reference.Bounds().Empty() || processed.Bounds().Empty() {
+		return Result{}
+	}
+	ref := premultiplied(reference)
+	w, h := ref.Bounds().Dx(), ref.Bounds().Dy()
+	if processed.Bounds().Dx() != w || processed.Bounds().Dy() != h {
+		processed = imaging.Resize(processed, w, h, imaging.Lanczos)
+	}
+	out := premultiplied(processed)
+
+	ssim, msssim := multiScaleSSIM(luma(ref), luma(out), w, h)
+	return Result{
+		PSNR:   round4(psnr(ref, out)),
+		SSIM:   round4(ssim),
+		MSSSIM: round4(msssim),
+	}
+}
+
+// PSNR 计算两张同尺寸图片的峰值信噪比（dB）
+func PSNR(reference, processed image.Image) float64 {
+	return psnr(premultiplied(reference), premultiplied(processed))
+}
+
+// SSIM 计算两张同尺寸图片亮度通道的平均结构相似度
+func SSIM(reference, processed image.Image) float64 {
+	ref, out := premultiplied(reference), premultiplied(processed)
+	ssim, _ := ssimStats(luma(ref), luma(out), ref.Bounds().Dx(), ref.Bounds().Dy())
+	return ssim
+}
+
+// MSSSIM 计算两张同尺寸图片亮度通道的多尺度结构相似度
+func MSSSIM(reference, processed image.Image) float64 {
+	ref, out := premultiplied(reference), premultiplied(processed)
+	_, msssim := multiScaleSSIM(luma(ref), luma(out), ref.Bounds().Dx(), ref.Bounds().Dy())
+	return msssim
+}
+
+// premultiplied 转换为 NRGBA 并将颜色按透明度预乘（透明度通道保持不变）
+func premultiplied(img image.Image) *image.NRGBA {
+	dst := imaging.Clone(img)
+	for i := 0; i+3 < len(dst.Pix); i += 4 {
+		a := uint32(dst.Pix[i+3])
+		if a == 0xff {
+			continue
+		}
+		for c := 0; c < 3; c++ {
+			dst.Pix[i+c] = uint8((uint32(dst.Pix[i+c])*a + 127) / 255)
+		}
+	}
+	return dst
+}
+
+func psnr(a, b *image.NRGBA) float64 {
+	var sum float64
+	n := 0
+	for i := 0; i+3 < len(a.Pix) && i+3 < len(b.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			d := float64(a.Pix[i+c]) - float64(b.Pix[i+c])
+			sum += d * d
+		}
+		n += 3
+	}
+	if n == 0 || sum == 0 {
+		return PSNRIdentical
+	}
+	return min(PSNRIdentical, 10*math.Log10(255*255/(sum/float64(n))))
+}
+
+// luma 按 BT.601 计算亮度平面
+func luma(img *image.NRGBA) []float32 {
+	plane := make([]float32, len(img.Pix)/4)
+	for i := range plane {
+		p := img.Pix[4*i:]
+		plane[i] = 0.299*float32(p[0]) + 0.587*float32(p[1]) + 0.114*float32(p[2])
+	}
+	return plane
+}
+
+func round4(v float64) float64 {
+	return math.Round(v*1e4) / 1e4
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func solid(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// texture 生成带纹理的测试图片，像素值留有余量，加偏移后不会截断
+func texture(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := 128 + 60*math.Sin(float64(x)/5)*math.Cos(float64(y)/7)
+			img.SetNRGBA(x, y, color.NRGBA{uint8(v), uint8(255 - v), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+// offset 将 RGB 各通道整体加上 d
+func offset(img *image.NRGBA, d int) *image.NRGBA {
+	dst := imaging.Clone(img)
+	for i := 0; i < len(dst.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			dst.Pix[i+c] = uint8(int(dst.Pix[i+c]) + d)
+		}
+	}
+	return dst
+}
+
+// addNoise 为 RGB 各通道叠加幅度为 amp 的均匀噪声
+func addNoise(img *image.NRGBA, amp int, seed int64) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	dst := imaging.Clone(img)
+	for i := 0; i < len(dst.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			v := int(dst.Pix[i+c]) + rng.Intn(2*amp+1) - amp
+			dst.Pix[i+c] = uint8(max(0, min(255, v)))
+		}
+	}
+	return dst
+}
+
+func TestCompareIdentical(t *testing.T) {
+	ref := texture(64, 64)
+	got := Compare(ref, imaging.Clone(ref))
+	if got.PSNR != PSNRIdentical || got.SSIM != 1 || got.MSSSIM != 1 {
+		t.Errorf("相同图片: %+v", got)
+	}
+	if p := PSNR(ref, ref); p != PSNRIdentical {
+		t.Errorf("PSNR = %v, 期望 %v", p, PSNRIdentical)
+	}
+	if s := SSIM(ref, ref); math.Abs(s-1) > 1e-9 {
+		t.Errorf("SSIM = %v, 期望 1", s)
+	}
+	if s := MSSSIM(ref, ref); math.Abs(s-1) > 1e-9 {
+		t.Errorf("MS-SSIM = %v, 期望 1", s)
+	}
+}
+
+func TestPSNRUniformOffset(t *testing.T) {
+	ref := texture(64, 64)
+	for _, d := range []int{1, 5, 10, 40} {
+		want := 20 * math.Log10(255/float64(d))
+		if got := PSNR(ref, offset(ref, d)); math.Abs(got-want) > 1e-9 {
+			t.Errorf("偏移 %d: PSNR = %v, 期望 %v", d, got, want)
+		}
+		if got := Compare(ref, offset(ref, d)).PSNR; math.Abs(got-want) > 1e-4 {
+			t.Errorf("偏移 %d: Compare PSNR = %v, 期望 %v", d, got, want)
+		}
+	}
+}
+
+func TestSSIMDegradedOrder(t *testing.T) {
+	ref := texture(128, 128)
+	for _, tc := range []struct {
+		name        string
+		mild, heavy *image.NRGBA
+	}{
+		{"blur", imaging.Blur(ref, 0.8), imaging.Blur(ref, 3)},
+		{"noise", addNoise(ref, 8, 1), addNoise(ref, 40, 1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mild, heavy := Compare(ref, tc.mild), Compare(ref, tc.heavy)
+			for _, m := range []Result{mild, heavy} {
+				if m.SSIM >= 1 || m.MSSSIM >= 1 || m.PSNR >= PSNRIdentical {
+					t.Errorf("损伤后的指标应低于相同图片: %+v", m)
+				}
+			}
+			// 损伤越重各项指标越低，SSIM 与 MS-SSIM 的排序一致
+			if heavy.SSIM >= mild.SSIM || heavy.MSSSIM >= mild.MSSSIM || heavy.PSNR >= mild.PSNR {
+				t.Errorf("重度损伤 %+v 应低于轻度损伤 %+v", heavy, mild)
+			}
+		})
+	}
+}
+
+func TestCompareTinyImages(t *testing.T) {
+	gray := color.NRGBA{128, 128, 128, 255}
+	for _, size := range []int{1, 2} {
+		ref := solid(size, size, gray)
+		if got := Compare(ref, solid(size, size, gray)); got.PSNR != PSNRIdentical || got.SSIM != 1 || got.MSSSIM != 1 {
+			t.Errorf("%dx%d 相同图片: %+v", size, size, got)
+		}
+		if got := Compare(ref, solid(size, size, color.NRGBA{0, 0, 0, 255})); got.PSNR >= PSNRIdentical {
+			t.Errorf("%dx%d 不同图片: %+v", size, size, got)
+		}
+		// 处理后尺寸变化时缩放回参考尺寸
+		Compare(ref, solid(size+3, size+1, gray))
+	}
+}
+
+func TestCompareEmptyImage(t *testing.T) {
+	ref := solid(1, 1, color.NRGBA{128, 128, 128, 255})
+	empty := image.NewNRGBA(image.Rect(0, 0, 0, 0))
+	if got := Compare(ref, empty); got != (Result{}) {
+		t.Errorf("处理结果为空图片: %+v", got)
+	}
+	if got := Compare(empty, ref); got != (Result{}) {
+		t.Errorf("参考图片为空: %+v", got)
+	}
+}
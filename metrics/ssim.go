@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"math"
+	"runtime"
+	"sync"
+)
+
+const (
+	ssimWindow = 11  // 高斯窗口大小
+	ssimSigma  = 1.5 // 高斯窗口标准差
+	ssimC1     = (0.01 * 255) * (0.01 * 255)
+	ssimC2     = (0.03 * 255) * (0.03 * 255)
+)
+
+// msssimWeights MS-SSIM 各尺度的权重（Wang 等, 2003）
+var msssimWeights = [5]float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+// ssimKernel 归一化的一维高斯窗口
+var ssimKernel = func() [ssimWindow]float32 {
+	var k [ssimWindow]float32
+	var sum float64
+	for i := range k {
+		d := float64(i - ssimWindow/2)
+		v := math.Exp(-d * d / (2 * ssimSigma * ssimSigma))
+		k[i] = float32(v)
+		sum += v
+	}
+	for i := range k {
+		k[i] /= float32(sum)
+	}
+	return k
+}()
+
+// multiScaleSSIM 返回原始尺度的 SSIM 和 MS-SSIM
+// 图片较小、无法缩小到5个尺度时只使用可用的尺度，并重新归一化权重
+func multiScaleSSIM(x, y []float32, w, h int) (float64, float64) {
+	levels := 1
+	for levels < len(msssimWeights) && min(w>>levels, h>>levels) >= ssimWindow {
+		levels++
+	}
+	var total float64
+	for _, weight := range msssimWeights[:levels] {
+		total += weight
+	}
+
+	var ssim0 float64
+	msssim := 1.0
+	for level := 0; level < levels; level++ {
+		ssim, cs := ssimStats(x, y, w, h)
+		if level == 0 {
+			ssim0 = ssim
+		}
+		v := cs
+		if level == levels-1 {
+			v = ssim
+		}
+		msssim *= math.Pow(math.Max(v, 0), msssimWeights[level]/total)
+		if level < levels-1 {
+			x, _, _ = downsample(x, w, h)
+			y, w, h = downsample(y, w, h)
+		}
+	}
+	return ssim0, msssim
+}
+
+// ssimStats 计算平均 SSIM 和平均对比度-结构分量（cs），按行分段并行计算
+func ssimStats(x, y []float32, w, h int) (float64, float64) {
+	if w == 0 || h == 0 {
+		return 1, 1
+	}
+
+	bands := min(runtime.GOMAXPROCS(0), max(1, h/64))
+	sums := make([][2]float64, bands)
+	var wg sync.WaitGroup
+	for b := 0; b < bands; b++ {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			sums[b][0], sums[b][1] = ssimBand(x, y, w, h, b*h/bands, (b+1)*h/bands)
+		}(b)
+	}
+	wg.Wait()
+
+	var ssimSum, csSum float64
+	for _, s := range sums {
+		ssimSum += s[0]
+		csSum += s[1]
+	}
+	n := float64(w * h)
+	return ssimSum / n, csSum / n
+}
+
+// ssimBand 计算 [r0, r1) 行的 SSIM 与 cs 之和
+// 先水平模糊各统计量，再在最近11行的环形缓冲区上垂直模糊，避免为整幅图保存多个浮点平面
+func ssimBand(x, y []float32, w, h, r0, r1 int) (float64, float64) {
+	const half = ssimWindow / 2
+	var rows [ssimWindow][5][]float32 // 各源行水平模糊后的 x、y、x²、y²、xy
+	var held [ssimWindow]int
+	for i := range rows {
+		for q := range rows[i] {
+			rows[i][q] = make([]float32, w)
+		}
+		held[i] = -1
+	}
+	var products, acc [5][]float32
+	for q := range products {
+		products[q] = make([]float32, w+2*half)
+		acc[q] = make([]float32, w)
+	}
+
+	// blurRow 返回源行 r 的水平模糊结果，已缓存时直接复用；边缘按最近像素延伸
+	blurRow := func(r int) *[5][]float32 {
+		slot := r % ssimWindow
+		if held[slot] == r {
+			return &rows[slot]
+		}
+		xr, yr := x[r*w:(r+1)*w], y[r*w:(r+1)*w]
+		for i := -half; i < w+half; i++ {
+			j := min(max(i, 0), w-1)
+			products[0][i+half] = xr[j]
+			products[1][i+half] = yr[j]
+			products[2][i+half] = xr[j] * xr[j]
+			products[3][i+half] = yr[j] * yr[j]
+			products[4][i+half] = xr[j] * yr[j]
+		}
+		for q := 0; q < 5; q++ {
+			src, dst := products[q], rows[slot][q]
+			for i := range dst {
+				var sum float32
+				for k, g := range ssimKernel {
+					sum += g * src[i+k]
+				}
+				dst[i] = sum
+			}
+		}
+		held[slot] = r
+		return &rows[slot]
+	}
+
+	var ssimSum, csSum float64
+	for r := r0; r < r1; r++ {
+		for q := range acc {
+			clear(acc[q])
+		}
+		for k, g := range ssimKernel {
+			row := blurRow(min(max(r+k-half, 0), h-1))
+			for q := 0; q < 5; q++ {
+				src, dst := row[q], acc[q]
+				for i := range dst {
+					dst[i] += g * src[i]
+				}
+			}
+		}
+
+		for i := 0; i < w; i++ {
+			mx, my := float64(acc[0][i]), float64(acc[1][i])
+			vx := float64(acc[2][i]) - mx*mx
+			vy := float64(acc[3][i]) - my*my
+			cov := float64(acc[4][i]) - mx*my
+
+			cs := (2*cov + ssimC2) / (vx + vy + ssimC2)
+			l := (2*mx*my + ssimC1) / (mx*mx + my*my + ssimC1)
+			ssimSum += l * cs
+			csSum += cs
+		}
+	}
+	return ssimSum, csSum
+}
+
+// downsample 按2×2均值缩小平面
+func downsample(p []float32, w, h int) ([]float32, int, int) {
+	nw, nh := w/2, h/2
+	out := make([]float32, nw*nh)
+	for y := 0; y < nh; y++ {
+		for x := 0; x < nw; x++ {
+			i := 2*y*w + 2*x
+			out[y*nw+x] = (p[i] + p[i+1] + p[i+w] + p[i+w+1]) / 4
+		}
+	}
+	return out, nw, nh
+}
@@ -34,7 +34,9 @@ var (
 	userMutex sync.RWMutex
 )
 
-func init() {
+// Init 创建默认管理员用户，需在 config.Init 之后调用
+// 不再放在包的 init 中，使 bench 等不需要认证的子命令可以在未配置 JWT_SECRET 时运行
+func Init() {
 	// 创建默认管理员用户，使用配置中的密码
 	createDefaultAdmin()
 }
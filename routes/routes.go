@@ -32,6 +32,7 @@ func SetupRoutes() *gin.Engine {
 	// 创建处理器
 	authHandler := handlers.NewAuthHandler()
 	imageHandler := handlers.NewImageHandler()
+	jobHandler := handlers.NewJobHandler()
 
 	// 公开路由 - 直接显示工作台界面
 	r.GET("/", func(c *gin.Context) {
@@ -96,6 +97,20 @@ func SetupRoutes() *gin.Engine {
 		{
 			// 图片处理API
 			apiAuth.POST("/attack", imageHandler.AttackWatermark)
+			apiAuth.POST("/attack/batch", imageHandler.AttackBatch)
+			apiAuth.POST("/analyze", imageHandler.Analyze)
+			apiAuth.POST("/evaluate", imageHandler.Evaluate)
+			apiAuth.GET("/presets", imageHandler.ListPresets)
+		}
+
+		// 异步任务API，仅提交任务受图片处理速率限制，便于客户端轮询状态
+		jobs := api.Group("/jobs")
+		jobs.Use(middleware.AuthMiddleware())
+		{
+			jobs.POST("", middleware.RateLimitMiddleware(10, time.Minute), jobHandler.Submit)
+			jobs.GET("/:id", jobHandler.Status)
+			jobs.GET("/:id/result", jobHandler.Result)
+			jobs.DELETE("/:id", jobHandler.Cancel)
 		}
 	}
 
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"image"
+	"strings"
+
+	"github.com/Neurocoda/Antimg/metrics"
+)
+
+// QualityMetric 自适应攻击使用的质量指标
+type QualityMetric string
+
+const (
+	MetricSSIM QualityMetric = "ssim"
+	MetricPSNR QualityMetric = "psnr"
+)
+
+// QualityTarget 自适应攻击的质量目标：在结果不低于目标的前提下寻找最强的攻击强度
+type QualityTarget struct {
+	Metric QualityMetric
+	Value  float64
+}
+
+// adaptiveSteps 二分搜索攻击强度的次数，精度约为 1/64
+const adaptiveSteps = 6
+
+// ParseQualityTarget 解析质量目标，ssim 取值 (0, 1)，psnr 取值为正数（dB）
+func ParseQualityTarget(metric string, value float64) (*QualityTarget, error) {
+	switch m := QualityMetric(strings.ToLower(metric)); m {
+	case MetricSSIM:
+		if value <= 0 || value >= 1 {
+			return nil, errors.New("targetSSIM 必须在0.0-1.0之间（不含端点）")
+		}
+		return &QualityTarget{Metric: m, Value: value}, nil
+	case MetricPSNR:
+		if value <= 0 || value > metrics.PSNRIdentical {
+			return nil, errors.New("targetPSNR 必须在0-100 dB之间")
+		}
+		return &QualityTarget{Metric: m, Value: value}, nil
+	}
+	return nil, errors.New("未知的质量指标: " + metric)
+}
+
+// met 质量指标是否达到目标
+func (t *QualityTarget) met(m metrics.Result) bool {
+	if t.Metric == MetricPSNR {
+		return m.PSNR >= t.Value
+	}
+	return m.SSIM >= t.Value
+}
+
+// adaptiveResult 自适应搜索的结果
+type adaptiveResult struct {
+	image   image.Image
+	level   float64
+	metrics metrics.Result
+	met     bool // 是否有强度达到了质量目标
+}
+
+// searchAttackLevel 使用固定种子二分搜索攻击强度，返回质量不低于目标的最强结果
+// 先尝试最大强度，不满足时在 [0, 1] 内二分；即使强度为0也无法达到目标时返回强度为0的结果
+func (s *ImageService) searchAttackLevel(ctx context.Context, img image.Image, opts ProcessOptions, pipeline Pipeline, seed int64) (*adaptiveResult, error) {
+	target := opts.Target
+	total := adaptiveSteps + 2
+	step := 0
+
+	try := func(level float64) (*adaptiveResult, error) {
+		run := opts
+		run.AttackLevel = level
+		if opts.Progress != nil {
+			// 将每次尝试的阶段进度折算为整体进度
+			base := step
+			run.Progress = func(completed, stages int) {
+				opts.Progress(base*stages+completed, total*stages)
+			}
+		}
+		step++
+
+		out, err := s.attackWatermark(ctx, img, run, pipeline, seed)
+		if err != nil {
+			return nil, err
+		}
+		m := metrics.Compare(img, out)
+		return &adaptiveResult{image: out, level: level, metrics: m, met: target.met(m)}, nil
+	}
+
+	best, err := try(1)
+	if err != nil || best.met {
+		return best, err
+	}
+
+	best = nil
+	lo, hi := 0.0, 1.0
+	for i := 0; i < adaptiveSteps; i++ {
+		mid := (lo + hi) / 2
+		r, err := try(mid)
+		if err != nil {
+			return nil, err
+		}
+		if r.met {
+			best, lo = r, mid
+		} else {
+			hi = mid
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+	return try(0)
+}
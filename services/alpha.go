@@ -0,0 +1,93 @@
+package services
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// splitAlpha 分离透明度通道：返回不透明的颜色图和以灰度保存的透明度平面
+// 图片完全不透明时透明度平面为 nil。完全透明像素的颜色由最近的可见像素延伸填充，
+// 避免模糊等操作把黑色渗入图案边缘
+func splitAlpha(img image.Image) (image.Image, *image.NRGBA) {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img, nil
+	}
+
+	src := imaging.Clone(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	opaque := true
+	for i := 3; i < len(src.Pix); i += 4 {
+		if src.Pix[i] != 0xff {
+			opaque = false
+			break
+		}
+	}
+	if opaque {
+		return src, nil
+	}
+
+	alpha := image.NewNRGBA(image.Rect(0, 0, w, h))
+	queue := make([]int, 0, w*h)
+	for i := 0; i < w*h; i++ {
+		a := src.Pix[4*i+3]
+		alpha.Pix[4*i+0] = a
+		alpha.Pix[4*i+1] = a
+		alpha.Pix[4*i+2] = a
+		alpha.Pix[4*i+3] = 0xff
+		if a > 0 {
+			queue = append(queue, i)
+		}
+		src.Pix[4*i+3] = 0xff
+	}
+
+	// 多源广度优先搜索，为完全透明的像素填充最近可见像素的颜色
+	known := make([]bool, w*h)
+	for _, i := range queue {
+		known[i] = true
+	}
+	for k := 0; k < len(queue); k++ {
+		i := queue[k]
+		x, y := i%w, i/w
+		for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if n[0] < 0 || n[0] >= w || n[1] < 0 || n[1] >= h {
+				continue
+			}
+			j := n[1]*w + n[0]
+			if known[j] {
+				continue
+			}
+			known[j] = true
+			copy(src.Pix[4*j:4*j+3], src.Pix[4*i:4*i+3])
+			queue = append(queue, j)
+		}
+	}
+
+	return src, alpha
+}
+
+// mergeAlpha 将透明度平面合并回处理后的颜色图，尺寸不一致时先缩放透明度平面
+func mergeAlpha(img image.Image, alpha *image.NRGBA) image.Image {
+	if alpha == nil {
+		return img
+	}
+
+	dst := imaging.Clone(img)
+	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+	if alpha.Bounds().Dx() != w || alpha.Bounds().Dy() != h {
+		alpha = imaging.Resize(alpha, w, h, imaging.Lanczos)
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := alpha.Pix[y*alpha.Stride+x*4]
+			p := dst.Pix[y*dst.Stride+x*4:]
+			if p[3] == 0 {
+				// 颜色图中已透明的位置（如透明填充的旋转角落）保持透明
+				a = 0
+			}
+			p[3] = a
+		}
+	}
+	return dst
+}
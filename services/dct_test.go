@@ -0,0 +1,30 @@
+package services
+
+import "testing"
+
+func TestDCTStage(t *testing.T) {
+	img := photoLike(67, 50)
+	for _, mode := range []string{"", "quantize", "perturb", "zero", "mixed"} {
+		params := StageParams{"mode": mode}
+		if out := applyStage(t, "dct", img, 0, params, 1); !samePixels(out, img) {
+			t.Errorf("%q: 强度为0时图片应保持不变", mode)
+		}
+
+		a := applyStage(t, "dct", img, 0.8, params, 1)
+		if b := applyStage(t, "dct", img, 0.8, params, 1); !samePixels(a, b) {
+			t.Errorf("%q: 相同种子的结果不一致", mode)
+		}
+		if samePixels(a, img) {
+			t.Errorf("%q: 强度大于0时图片应被修改", mode)
+		}
+		if a.Bounds().Size() != img.Bounds().Size() {
+			t.Errorf("%q: 尺寸 %v", mode, a.Bounds().Size())
+		}
+
+		// quantize 不使用随机源，其余方式不同种子的结果应不同
+		b := applyStage(t, "dct", img, 0.8, params, 2)
+		if same := samePixels(a, b); same != (mode == "quantize") {
+			t.Errorf("%q: 不同种子的结果相同 = %v", mode, same)
+		}
+	}
+}
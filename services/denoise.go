@@ -0,0 +1,316 @@
+package services
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/disintegration/imaging"
+)
+
+func init() {
+	RegisterStage(medianStage{})
+	RegisterStage(bilateralStage{})
+	RegisterStage(nlmStage{})
+}
+
+// 加性水印通常类似噪声，保边去噪比模糊更干净地去除水印能量，同时保留纹理和边缘。
+// 以下滤波越界位置均取边缘像素，按行分段并行计算，每处理一行检查一次上下文
+
+// medianStage 中值滤波，逐通道取窗口内的中值
+// 参数: radius 窗口半径（默认随强度为1-3，即3×3到7×7）
+type medianStage struct{}
+
+func (medianStage) Name() string { return "median" }
+
+func (medianStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	radius := params.Int("radius", 1+int(level*2))
+	if level <= 0 || radius < 1 {
+		return img, nil
+	}
+
+	src := imaging.Clone(img)
+	dst := image.NewNRGBA(src.Bounds())
+	err := parallelRows(env, src.Bounds().Dy(), func(y0, y1 int) {
+		medianRows(env, src, dst, radius, y0, y1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// medianRows 计算 [y0, y1) 行，每行从左到右滑动窗口并增量维护直方图和中值（Huang 算法）
+func medianRows(env *StageEnv, src, dst *image.NRGBA, radius, y0, y1 int) {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	half := int32((2*radius + 1) * (2*radius + 1) / 2)
+
+	for y := y0; y < y1; y++ {
+		if env.Err() != nil {
+			return
+		}
+		var hist [3][256]int32
+		var med [3]int     // 各通道当前中值
+		var below [3]int32 // 各通道窗口内小于中值的像素个数
+
+		// column 将第 x 列加入（delta=1）或移出（delta=-1）窗口
+		column := func(x int, delta int32) {
+			x = max(0, min(w-1, x))
+			for dy := -radius; dy <= radius; dy++ {
+				p := src.Pix[max(0, min(h-1, y+dy))*src.Stride+4*x:]
+				for c := 0; c < 3; c++ {
+					hist[c][p[c]] += delta
+					if int(p[c]) < med[c] {
+						below[c] += delta
+					}
+				}
+			}
+		}
+		for x := -radius; x <= radius; x++ {
+			column(x, 1)
+		}
+
+		for x := 0; x < w; x++ {
+			if x > 0 {
+				column(x-radius-1, -1)
+				column(x+radius, 1)
+			}
+
+			d := dst.Pix[y*dst.Stride+4*x:]
+			for c := 0; c < 3; c++ {
+				for below[c] > half {
+					med[c]--
+					below[c] -= hist[c][med[c]]
+				}
+				for below[c]+hist[c][med[c]] <= half {
+					below[c] += hist[c][med[c]]
+					med[c]++
+				}
+				d[c] = uint8(med[c])
+			}
+			d[3] = 0xff
+		}
+	}
+}
+
+// bilateralStage 双边滤波，按空间距离和颜色差异加权平均，平滑噪声的同时保留边缘
+// 参数: radius 窗口半径（默认随强度为1-4），sigmaColor 颜色差异的标准差（默认随强度为10-50），
+// sigmaSpace 空间距离的标准差（默认为 radius/2+0.5）
+type bilateralStage struct{}
+
+func (bilateralStage) Name() string { return "bilateral" }
+
+func (bilateralStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	radius := params.Int("radius", 1+int(level*3))
+	sigmaColor := params.Float("sigmaColor", 10+40*level)
+	sigmaSpace := params.Float("sigmaSpace", float64(radius)/2+0.5)
+	if level <= 0 || radius < 1 || sigmaColor <= 0 || sigmaSpace <= 0 {
+		return img, nil
+	}
+
+	size := 2*radius + 1
+	spatial := make([]float32, size*size)
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			spatial[(dy+radius)*size+dx+radius] = float32(math.Exp(-float64(dx*dx+dy*dy) / (2 * sigmaSpace * sigmaSpace)))
+		}
+	}
+	// 颜色权重按 RGB 差的平方和查表
+	rangeWeight := make([]float32, 3*255*255+1)
+	for d := range rangeWeight {
+		rangeWeight[d] = float32(math.Exp(-float64(d) / (2 * sigmaColor * sigmaColor)))
+	}
+
+	src := imaging.Clone(img)
+	dst := image.NewNRGBA(src.Bounds())
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	err := parallelRows(env, h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			if env.Err() != nil {
+				return
+			}
+			for x := 0; x < w; x++ {
+				center := src.Pix[y*src.Stride+4*x:]
+				r0, g0, b0 := int(center[0]), int(center[1]), int(center[2])
+				var sum [3]float32
+				var total float32
+				for dy := -radius; dy <= radius; dy++ {
+					row := src.Pix[max(0, min(h-1, y+dy))*src.Stride:]
+					for dx := -radius; dx <= radius; dx++ {
+						p := row[4*max(0, min(w-1, x+dx)):]
+						dr, dg, db := int(p[0])-r0, int(p[1])-g0, int(p[2])-b0
+						weight := spatial[(dy+radius)*size+dx+radius] * rangeWeight[dr*dr+dg*dg+db*db]
+						sum[0] += weight * float32(p[0])
+						sum[1] += weight * float32(p[1])
+						sum[2] += weight * float32(p[2])
+						total += weight
+					}
+				}
+				d := dst.Pix[y*dst.Stride+4*x:]
+				for c := 0; c < 3; c++ {
+					d[c] = clampUint8(float64(sum[c] / total))
+				}
+				d[3] = 0xff
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// nlmStage 基础的非局部均值去噪：以亮度块的相似度为权重，对搜索窗口内的像素加权平均
+// 参数: search 搜索窗口半径（默认随强度为1-4），patch 比较块半径（默认1，即3×3），
+// h 滤波强度（默认随强度为5-25，越大越平滑）
+type nlmStage struct{}
+
+func (nlmStage) Name() string { return "nlm" }
+
+// nlmTableMax、nlmTableSteps 权重 exp(-t) 查找表覆盖 t∈[0, nlmTableMax)，超出部分权重视为0
+const (
+	nlmTableMax   = 10
+	nlmTableSteps = 4096
+)
+
+func (nlmStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	search := params.Int("search", 1+int(level*3))
+	patch := params.Int("patch", 1)
+	strength := params.Float("h", 5+20*level)
+	if level <= 0 || search < 1 || patch < 0 || strength <= 0 {
+		return img, nil
+	}
+
+	src := imaging.Clone(img)
+	dst := image.NewNRGBA(src.Bounds())
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// 块距离只在亮度上计算，再用同一组权重平均 RGB；亮度平面四周按边缘像素扩展 pad 个像素
+	pad := search + patch
+	pw := w + 2*pad
+	luma := make([]float32, pw*(h+2*pad))
+	for y := -pad; y < h+pad; y++ {
+		row := src.Pix[max(0, min(h-1, y))*src.Stride:]
+		for x := -pad; x < w+pad; x++ {
+			p := row[4*max(0, min(w-1, x)):]
+			luma[(y+pad)*pw+x+pad] = 0.299*float32(p[0]) + 0.587*float32(p[1]) + 0.114*float32(p[2])
+		}
+	}
+
+	var table [nlmTableSteps]float32
+	for i := range table {
+		table[i] = float32(math.Exp(-float64(i) * nlmTableMax / nlmTableSteps))
+	}
+	// 块内平方差之和乘以 scale 即为查找表下标
+	scale := float64(nlmTableSteps / nlmTableMax / (strength * strength * float64((2*patch+1)*(2*patch+1))))
+
+	err := parallelRows(env, h, func(y0, y1 int) {
+		n := (y1 - y0) * w
+		sum := [3][]float32{make([]float32, n), make([]float32, n), make([]float32, n)}
+		total := make([]float32, n)
+		rows := y1 - y0 + 2*patch
+		hbox := make([]float32, rows*w) // 平方差按行做盒式求和的结果
+		diff := make([]float32, w+2*patch)
+		column := make([]float64, w) // 滑动累加使用 float64，避免长行或高分段上的累积误差
+
+		// 逐个偏移量计算全部像素的块距离，比逐像素比较块快一个数量级
+		for sy := -search; sy <= search; sy++ {
+			for sx := -search; sx <= search; sx++ {
+				if sx == 0 && sy == 0 {
+					continue
+				}
+				for r := 0; r < rows; r++ {
+					if env.Err() != nil {
+						return
+					}
+					a := luma[(y0-patch+r+pad)*pw+pad-patch:]
+					b := luma[(y0-patch+r+sy+pad)*pw+pad-patch+sx:]
+					for i := range diff {
+						d := a[i] - b[i]
+						diff[i] = d * d
+					}
+					var acc float64
+					for i := 0; i < 2*patch; i++ {
+						acc += float64(diff[i])
+					}
+					out := hbox[r*w : (r+1)*w]
+					for x := range out {
+						acc += float64(diff[x+2*patch])
+						out[x] = float32(acc)
+						acc -= float64(diff[x])
+					}
+				}
+
+				clear(column)
+				for r := 0; r < 2*patch; r++ {
+					for x, v := range hbox[r*w : (r+1)*w] {
+						column[x] += float64(v)
+					}
+				}
+				for y := y0; y < y1; y++ {
+					if env.Err() != nil {
+						return
+					}
+					r := y - y0
+					for x, v := range hbox[(r+2*patch)*w : (r+2*patch+1)*w] {
+						column[x] += float64(v)
+					}
+					srcRow := src.Pix[max(0, min(h-1, y+sy))*src.Stride:]
+					base := r * w
+					for x := 0; x < w; x++ {
+						idx := max(0, int(column[x]*scale))
+						if idx >= nlmTableSteps {
+							continue
+						}
+						weight := table[idx]
+						p := srcRow[4*max(0, min(w-1, x+sx)):]
+						sum[0][base+x] += weight * float32(p[0])
+						sum[1][base+x] += weight * float32(p[1])
+						sum[2][base+x] += weight * float32(p[2])
+						total[base+x] += weight
+					}
+					for x, v := range hbox[r*w : (r+1)*w] {
+						column[x] -= float64(v)
+					}
+				}
+			}
+		}
+
+		// 中心像素与自身的块距离为0，权重为1
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				i := (y-y0)*w + x
+				center := src.Pix[y*src.Stride+4*x:]
+				d := dst.Pix[y*dst.Stride+4*x:]
+				for c := 0; c < 3; c++ {
+					d[c] = clampUint8(float64((sum[c][i] + float32(center[c])) / (total[i] + 1)))
+				}
+				d[3] = 0xff
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// parallelRows 将 [0, h) 行分段并行交给 fn 处理，返回上下文的结束原因；
+// fn 应逐行检查上下文，结束后尽快返回，此时的部分结果会被丢弃
+func parallelRows(env *StageEnv, h int, fn func(y0, y1 int)) error {
+	bands := min(runtime.GOMAXPROCS(0)*4, max(1, h/16))
+	var wg sync.WaitGroup
+	for b := 0; b < bands; b++ {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			if env.Err() != nil {
+				return
+			}
+			fn(b*h/bands, (b+1)*h/bands)
+		}(b)
+	}
+	wg.Wait()
+	return env.Err()
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func flatImage(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// 纯色图片没有可去除的噪声，任何强度下都应保持不变
+func TestDenoiseFlatImageUnchanged(t *testing.T) {
+	img := flatImage(40, 30, color.NRGBA{90, 140, 200, 255})
+	for _, name := range []string{"median", "bilateral", "nlm"} {
+		for _, level := range []float64{0.3, 1} {
+			if out := applyStage(t, name, img, level, nil, 1); !samePixels(out, img) {
+				t.Errorf("%s 强度 %v: 纯色图片被修改", name, level)
+			}
+		}
+	}
+}
+
+func TestMedianRemovesSaltAndPepper(t *testing.T) {
+	gray := color.NRGBA{128, 128, 128, 255}
+	img := flatImage(64, 64, gray)
+	rng := rand.New(rand.NewSource(1))
+	noisy := 0
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			switch r := rng.Float64(); {
+			case r < 0.03:
+				img.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255})
+				noisy++
+			case r < 0.06:
+				img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+				noisy++
+			}
+		}
+	}
+	if noisy == 0 {
+		t.Fatal("没有生成噪声点")
+	}
+
+	out := applyStage(t, "median", img, 1, StageParams{"radius": 2}, 1)
+	if !samePixels(out, flatImage(64, 64, gray)) {
+		t.Errorf("中值滤波后仍有噪声点（共 %d 个）", noisy)
+	}
+}
+
+// 去噪阶段在上下文结束后应在当前行处理完后尽快返回，而不是处理完整个分段
+func TestDenoiseStagesStopOnCancel(t *testing.T) {
+	// 窄而高的图片：单行耗时短，整体耗时长
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 2048))
+	for y := 0; y < 2048; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x ^ y), 255})
+		}
+	}
+
+	for _, tc := range []struct {
+		stage  string
+		params StageParams
+	}{
+		{"median", StageParams{"radius": 40}},
+		{"bilateral", StageParams{"radius": 40}},
+		{"nlm", StageParams{"search": 40}},
+	} {
+		t.Run(tc.stage, func(t *testing.T) {
+			stage, _ := GetStage(tc.stage)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			_, err := stage.Apply(&StageEnv{Ctx: ctx}, img, 1, tc.params)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("err = %v, 期望 context.DeadlineExceeded", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("取消后 %v 才返回", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/Neurocoda/Antimg/transform"
+)
+
+func init() {
+	RegisterStage(dwtStage{})
+}
+
+// DWTMode DWT 阶段对细节子带的处理方式
+type DWTMode string
+
+const (
+	DWTAttenuate  DWTMode = "attenuate"  // 按比例衰减
+	DWTRequantize DWTMode = "requantize" // 按带随机偏移的步长重新量化
+	DWTMixed      DWTMode = "mixed"      // 先重新量化再衰减
+)
+
+// ParseDWTMode 解析 DWT 处理方式，为空时使用 mixed
+func ParseDWTMode(s string) (DWTMode, error) {
+	switch mode := DWTMode(s); mode {
+	case "":
+		return DWTMixed, nil
+	case DWTAttenuate, DWTRequantize, DWTMixed:
+		return mode, nil
+	}
+	return "", errors.New("mode 参数仅支持 attenuate、requantize 或 mixed")
+}
+
+const (
+	// dwtMaxDepth 允许的最大分解级数
+	dwtMaxDepth = 6
+	// dwtMaxStep 强度为1时第1级细节系数的量化步长，每深一级步长加倍（与正交小波的系数增益一致）
+	dwtMaxStep = 16
+	// dwtMaxAttenuation 强度为1时细节系数的衰减比例
+	dwtMaxAttenuation = 0.6
+)
+
+// dwtStage 小波域攻击，对指定分解级的细节子带（LH、HL、HH）做衰减或重新量化，
+// 针对嵌入在小波子带中的水印
+// 参数: wavelet 小波 haar（默认）或 db4，depth 分解级数（默认3），
+// bands 处理的分解级，逗号分隔（如 "2,3"，默认全部），mode 处理方式 attenuate、requantize、mixed（默认），
+// strength 强度倍数，chroma 色度通道的强度倍数（默认0.5，0 表示只处理亮度）
+type dwtStage struct{}
+
+func (dwtStage) Name() string { return "dwt" }
+
+func (dwtStage) ValidateParams(params StageParams) error {
+	_, _, _, _, err := parseDWTParams(params)
+	return err
+}
+
+func (dwtStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	wavelet, mode, depth, bands, err := parseDWTParams(params)
+	if err != nil {
+		return nil, err
+	}
+	strength := level * params.Float("strength", 1)
+	if strength <= 0 {
+		return img, nil
+	}
+	chroma := params.Float("chroma", 0.5)
+
+	y, cb, cr := transform.ToYCbCr(img)
+	planes := []**transform.Plane{&y}
+	scales := []float64{1}
+	if chroma > 0 {
+		planes = append(planes, &cb, &cr)
+		scales = append(scales, chroma, chroma)
+	}
+
+	for i, plane := range planes {
+		if err := env.Err(); err != nil {
+			return nil, err
+		}
+		*plane = attackDWTPlane(*plane, env.Rng, wavelet, mode, depth, bands, strength*scales[i])
+	}
+	return transform.FromYCbCr(y, cb, cr), nil
+}
+
+// parseDWTParams 解析小波、处理方式、分解级数和要处理的分解级
+func parseDWTParams(params StageParams) (transform.Wavelet, DWTMode, int, []bool, error) {
+	wavelet, err := transform.ParseWavelet(params.String("wavelet", ""))
+	if err != nil {
+		return transform.Wavelet{}, "", 0, nil, err
+	}
+	mode, err := ParseDWTMode(params.String("mode", ""))
+	if err != nil {
+		return transform.Wavelet{}, "", 0, nil, err
+	}
+	depth := params.Int("depth", 3)
+	if depth < 1 || depth > dwtMaxDepth {
+		return transform.Wavelet{}, "", 0, nil, fmt.Errorf("depth 参数必须在1-%d之间", dwtMaxDepth)
+	}
+
+	// bands[j] 表示是否处理第 j+1 级的细节子带
+	bands := make([]bool, depth)
+	var list []string
+	switch v := params["bands"].(type) {
+	case nil:
+	case float64:
+		list = []string{strconv.Itoa(int(v))}
+	case int:
+		list = []string{strconv.Itoa(v)}
+	case string:
+		list = strings.Split(v, ",")
+	default:
+		return transform.Wavelet{}, "", 0, nil, errors.New("bands 参数格式错误")
+	}
+	if len(list) == 0 {
+		for j := range bands {
+			bands[j] = true
+		}
+	}
+	for _, s := range list {
+		j, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || j < 1 || j > depth {
+			return transform.Wavelet{}, "", 0, nil, fmt.Errorf("bands 参数必须是1-%d之间的分解级", depth)
+		}
+		bands[j-1] = true
+	}
+	return wavelet, mode, depth, bands, nil
+}
+
+// attackDWTPlane 对平面做 depth 级分解，处理选中级的细节子带后重建
+func attackDWTPlane(p *transform.Plane, rng *rand.Rand, w transform.Wavelet, mode DWTMode, depth int, bands []bool, strength float64) *transform.Plane {
+	levels := make([]*transform.Subbands, 0, depth)
+	ll := p
+	for j := 0; j < depth && ll.Width >= 2 && ll.Height >= 2; j++ {
+		s := transform.DWT(ll, w)
+		levels = append(levels, s)
+		ll = s.LL
+	}
+
+	gain := 1 - math.Min(strength, 1)*dwtMaxAttenuation
+	for j, s := range levels {
+		if !bands[j] {
+			continue
+		}
+		step := strength * dwtMaxStep * math.Pow(2, float64(j))
+		for _, band := range []*transform.Plane{s.LH, s.HL, s.HH} {
+			// 每个子带使用不同的随机格点偏移，避免与按固定格点量化的水印重合
+			offset := rng.Float64() * step
+			for i, c := range band.Pix {
+				if mode != DWTAttenuate {
+					c = quantize(c-offset, step) + offset
+				}
+				if mode != DWTRequantize {
+					c *= gain
+				}
+				band.Pix[i] = c
+			}
+		}
+	}
+
+	for j := len(levels) - 1; j >= 0; j-- {
+		rebuilt := levels[j].Inverse()
+		if j > 0 {
+			levels[j-1].LL = rebuilt
+		} else {
+			p = rebuilt
+		}
+	}
+	return p
+}
@@ -0,0 +1,33 @@
+package services
+
+import "testing"
+
+func TestDWTStage(t *testing.T) {
+	img := photoLike(67, 50)
+	for _, params := range []StageParams{
+		nil,
+		{"wavelet": "db4", "mode": "requantize", "depth": 2},
+		{"mode": "attenuate", "bands": "1"},
+	} {
+		if out := applyStage(t, "dwt", img, 0, params, 1); !samePixels(out, img) {
+			t.Errorf("%v: 强度为0时图片应保持不变", params)
+		}
+
+		a := applyStage(t, "dwt", img, 0.6, params, 1)
+		if b := applyStage(t, "dwt", img, 0.6, params, 1); !samePixels(a, b) {
+			t.Errorf("%v: 相同种子的结果不一致", params)
+		}
+		if samePixels(a, img) {
+			t.Errorf("%v: 强度大于0时图片应被修改", params)
+		}
+		if a.Bounds().Size() != img.Bounds().Size() {
+			t.Errorf("%v: 尺寸 %v, 期望 %v", params, a.Bounds().Size(), img.Bounds().Size())
+		}
+	}
+
+	// 只有重新量化使用随机偏移，不同种子的结果应不同
+	a := applyStage(t, "dwt", img, 0.6, nil, 1)
+	if b := applyStage(t, "dwt", img, 0.6, nil, 2); samePixels(a, b) {
+		t.Error("不同种子的结果相同")
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"time"
+
+	"github.com/Neurocoda/Antimg/codec"
+	"github.com/Neurocoda/Antimg/metrics"
+	"github.com/Neurocoda/Antimg/watermark"
+	"github.com/disintegration/imaging"
+)
+
+// EvaluateOptions 水印攻击效果评估的参数
+type EvaluateOptions struct {
+	Process ProcessOptions // 攻击参数，输出编码参数不使用
+	Schemes []string       // 参与评估的水印算法，为空时使用全部算法
+	Payload []bool         // 嵌入的载荷比特，为空时由密钥生成64位随机载荷
+	Key     *int64         // 水印密钥，为空时随机生成
+}
+
+// defaultPayloadBits 未指定载荷时随机载荷的长度
+const defaultPayloadBits = 64
+
+// WatermarkReport 单个水印算法的评估结果
+type WatermarkReport struct {
+	Scheme      string         `json:"scheme"`
+	Bits        int            `json:"bits"`
+	EmbedPSNR   float64        `json:"embed_psnr"`   // 嵌入水印本身造成的失真（dB）
+	BERBefore   float64        `json:"ber_before"`   // 攻击前的误码率，用于确认水印已正确嵌入
+	BER         float64        `json:"ber"`          // 攻击后的误码率
+	Detected    bool           `json:"detected"`     // 攻击后水印是否仍可检测
+	AttackLevel float64        `json:"attack_level"` // 实际使用的攻击强度
+	AttackMS    float64        `json:"attack_ms"`    // 攻击耗时（毫秒），不含水印嵌入和提取
+	Metrics     metrics.Result `json:"metrics"`      // 攻击结果相对含水印图片的质量指标
+}
+
+// EvaluateResult 评估结果
+type EvaluateResult struct {
+	Seed    int64             `json:"seed"`
+	Key     int64             `json:"key"`
+	Reports []WatermarkReport `json:"reports"`
+}
+
+// Evaluate 解码上传的图片并评估攻击效果，见 EvaluateImage
+func (s *ImageService) Evaluate(ctx context.Context, src io.Reader, opts EvaluateOptions) (*EvaluateResult, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	img, _, meta, err := s.decodeInput(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	if p, err := codec.ParseICC(meta.ICC); err == nil {
+		img = p.ToSRGB(img)
+	}
+	return s.EvaluateImage(ctx, img, opts)
+}
+
+// EvaluateImage 依次用各参考水印算法嵌入载荷，执行攻击后提取水印并统计误码率
+// 攻击改变了图片尺寸时，先缩放回含水印图片的尺寸再提取
+func (s *ImageService) EvaluateImage(ctx context.Context, img image.Image, opts EvaluateOptions) (*EvaluateResult, error) {
+	pipeline, seed := opts.Process.resolve()
+	if opts.Key == nil {
+		key := newSeed()
+		opts.Key = &key
+	}
+	if len(opts.Payload) == 0 {
+		opts.Payload = watermark.RandomBits(defaultPayloadBits, *opts.Key)
+	}
+
+	schemes := opts.Schemes
+	if len(schemes) == 0 {
+		schemes = watermark.Names()
+	}
+
+	result := &EvaluateResult{Seed: seed, Key: *opts.Key}
+	for _, name := range schemes {
+		scheme, ok := watermark.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("未知的水印算法: %s", name)
+		}
+		report, err := s.evaluateScheme(ctx, img, scheme, opts, pipeline, seed)
+		if err != nil {
+			return nil, wrapContextError(ctx, err)
+		}
+		result.Reports = append(result.Reports, *report)
+	}
+	return result, nil
+}
+
+// evaluateScheme 评估单个水印算法
+func (s *ImageService) evaluateScheme(ctx context.Context, img image.Image, scheme watermark.Scheme, opts EvaluateOptions, pipeline Pipeline, seed int64) (*WatermarkReport, error) {
+	marked, err := scheme.Embed(img, opts.Payload, *opts.Key)
+	if err != nil {
+		return nil, err
+	}
+	before, err := scheme.Extract(marked, len(opts.Payload), *opts.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	process := opts.Process
+	process.SkipMetrics = false
+	start := time.Now()
+	attacked, err := s.runAttack(ctx, marked, process, pipeline, seed)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+
+	out := attacked.image
+	w, h := marked.Bounds().Dx(), marked.Bounds().Dy()
+	if out.Bounds().Dx() != w || out.Bounds().Dy() != h {
+		out = imaging.Resize(out, w, h, imaging.Lanczos)
+	}
+	after, err := scheme.Extract(out, len(opts.Payload), *opts.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	ber := watermark.BER(opts.Payload, after)
+	return &WatermarkReport{
+		Scheme:      scheme.Name(),
+		Bits:        len(opts.Payload),
+		EmbedPSNR:   math.Round(metrics.PSNR(img, marked)*1e4) / 1e4,
+		BERBefore:   watermark.BER(opts.Payload, before),
+		BER:         ber,
+		Detected:    ber <= watermark.DetectionThreshold,
+		AttackLevel: attacked.level,
+		AttackMS:    math.Round(float64(elapsed.Microseconds())) / 1000,
+		Metrics:     *attacked.metrics,
+	}, nil
+}
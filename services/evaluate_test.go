@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/Neurocoda/Antimg/watermark"
+)
+
+// photoLike 生成带平滑渐变和纹理的测试图片
+func photoLike(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := 128 + 60*math.Sin(float64(x)/23) + 40*math.Cos(float64(y)/17)
+			img.SetNRGBA(x, y, color.NRGBA{uint8(v), uint8(255 - v), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+func TestEvaluateImage(t *testing.T) {
+	service := NewImageService(0, PixelLimit{})
+	img := photoLike(256, 256)
+	zero := 0.0
+
+	for _, tc := range []struct {
+		name     string
+		process  ProcessOptions
+		survived bool
+	}{
+		// 唯一的阶段强度为0，图片不被修改，全部水印完整保留
+		{"identity", ProcessOptions{Pipeline: Pipeline{{Name: "dct", Level: &zero}}}, true},
+		// 默认处理流程在中等强度下破坏全部参考水印
+		{"default", ProcessOptions{AttackLevel: 0.6}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			seed, key := int64(1), int64(2)
+			tc.process.Seed = &seed
+			result, err := service.EvaluateImage(context.Background(), img, EvaluateOptions{Process: tc.process, Key: &key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Seed != seed || result.Key != key {
+				t.Errorf("seed = %d, key = %d", result.Seed, result.Key)
+			}
+			if len(result.Reports) != len(watermark.Names()) {
+				t.Fatalf("%d 个报告，期望每个算法一个", len(result.Reports))
+			}
+
+			for _, r := range result.Reports {
+				if r.Bits != defaultPayloadBits || r.BERBefore != 0 {
+					t.Errorf("%s: bits = %d, ber_before = %v", r.Scheme, r.Bits, r.BERBefore)
+				}
+				if r.Detected != (r.BER <= watermark.DetectionThreshold) {
+					t.Errorf("%s: detected = %v 与 BER %v 不一致", r.Scheme, r.Detected, r.BER)
+				}
+				if r.Detected != tc.survived {
+					t.Errorf("%s: BER = %v, detected = %v, 期望 %v", r.Scheme, r.BER, r.Detected, tc.survived)
+				}
+				if tc.survived && r.BER != 0 {
+					t.Errorf("%s: 未修改图片的 BER = %v, 期望 0", r.Scheme, r.BER)
+				}
+				if !tc.survived && (r.BER < 0.25 || r.Metrics.SSIM >= 1) {
+					t.Errorf("%s: BER = %v, SSIM = %v，期望水印被破坏且画面有损伤", r.Scheme, r.BER, r.Metrics.SSIM)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/Neurocoda/Antimg/codec"
+
+	"github.com/disintegration/imaging"
+)
+
+// FillMode 旋转后图片边缘空白区域的填充方式
+type FillMode string
+
+const (
+	FillTransparent FillMode = "transparent" // 透明填充，画布扩大到旋转后的外接矩形
+	FillEdge        FillMode = "edge"        // 延伸边缘像素，保持原尺寸
+	FillMirror      FillMode = "mirror"      // 镜像边缘像素，保持原尺寸
+	FillCrop        FillMode = "crop"        // 裁剪到内接矩形后缩放回原尺寸
+)
+
+// ParseFillMode 解析填充方式，为空时使用透明填充
+func ParseFillMode(s string) (FillMode, error) {
+	switch mode := FillMode(s); mode {
+	case "":
+		return FillTransparent, nil
+	case FillTransparent, FillEdge, FillMirror, FillCrop:
+		return mode, nil
+	}
+	return "", fmt.Errorf("未知的填充方式: %s，仅支持 transparent、edge、mirror、crop", s)
+}
+
+// validateFillParam 检查阶段参数中的 fill 填充方式
+func validateFillParam(params StageParams) error {
+	_, err := ParseFillMode(params.String("fill", ""))
+	return err
+}
+
+// fillMode 读取阶段参数中的旋转填充方式，未指定时使用运行环境的默认值
+func (e *StageEnv) fillMode(params StageParams) (FillMode, error) {
+	if s := params.String("fill", ""); s != "" || e.fill == "" {
+		return ParseFillMode(s)
+	}
+	return e.fill, nil
+}
+
+// defaultFill 旋转的默认填充方式：透明度能够保留到输出时透明填充，
+// 不透明的图片或不支持透明度的输出格式（如 JPEG）镜像填充，避免角落出现黑色
+func defaultFill(hasAlpha bool, outputFormat string) FillMode {
+	if hasAlpha && codec.SupportsAlpha(outputFormat) {
+		return FillTransparent
+	}
+	return FillMirror
+}
+
+// Rotate 按填充方式逆时针旋转图片（角度制），透明度通道同步旋转
+func (e *StageEnv) Rotate(img image.Image, angle float64, fill FillMode) image.Image {
+	if e.alpha != nil {
+		e.alpha = rotateFill(e.alpha, angle, fill, color.Black)
+	}
+	return rotateFill(img, angle, fill, color.Transparent)
+}
+
+// Resize 缩放图片，透明度通道同步缩放
+func (e *StageEnv) Resize(img image.Image, width, height int) image.Image {
+	if e.alpha != nil {
+		e.alpha = imaging.Resize(e.alpha, width, height, imaging.Lanczos)
+	}
+	return imaging.Resize(img, width, height, imaging.Lanczos)
+}
+
+// CropCenter 从中心裁剪图片，透明度通道同步裁剪
+func (e *StageEnv) CropCenter(img image.Image, width, height int) image.Image {
+	if e.alpha != nil {
+		e.alpha = imaging.CropCenter(e.alpha, width, height)
+	}
+	return imaging.CropCenter(img, width, height)
+}
+
+// Remap 按坐标映射重采样为 w×h 的图片（见 remap），透明度通道同步重采样
+func (e *StageEnv) Remap(img image.Image, w, h int, mapping func(x, y int) (float64, float64), fill FillMode) image.Image {
+	if e.alpha != nil {
+		e.alpha = remap(e.alpha, w, h, mapping, fill)
+	}
+	return remap(img, w, h, mapping, fill)
+}
+
+// SelectLines 按索引挑选源图的行和列组成新图片，索引可以重复或跳过，透明度通道同步处理
+func (e *StageEnv) SelectLines(img image.Image, rows, cols []int) image.Image {
+	if e.alpha != nil {
+		e.alpha = selectLines(e.alpha, rows, cols)
+	}
+	return selectLines(img, rows, cols)
+}
+
+// rotateFill 旋转单张图片，bg 为透明填充方式下的背景色
+func rotateFill(img image.Image, angle float64, fill FillMode, bg color.Color) *image.NRGBA {
+	switch fill {
+	case FillEdge, FillMirror:
+		return rotateInPlace(img, angle, fill)
+	case FillCrop:
+		b := img.Bounds()
+		rotated := rotateInPlace(img, angle, FillEdge)
+		w, h := inscribedSize(b.Dx(), b.Dy(), angle)
+		cropped := imaging.CropCenter(rotated, w, h)
+		return imaging.Resize(cropped, b.Dx(), b.Dy(), imaging.Lanczos)
+	}
+	return imaging.Rotate(img, angle, bg)
+}
+
+// rotateInPlace 绕中心旋转并保持原尺寸，越界位置按填充方式取边缘或镜像像素，双线性插值
+func rotateInPlace(img image.Image, angle float64, fill FillMode) *image.NRGBA {
+	b := img.Bounds()
+	sin, cos := math.Sincos(math.Pi * angle / 180)
+	cx, cy := float64(b.Dx())/2-0.5, float64(b.Dy())/2-0.5
+
+	return remap(img, b.Dx(), b.Dy(), func(x, y int) (float64, float64) {
+		dx, dy := float64(x)-cx, float64(y)-cy
+		return dx*cos - dy*sin + cx, dx*sin + dy*cos + cy
+	}, fill)
+}
+
+// remap 生成 w×h 的图片，每个目标像素 (x, y) 取源图中 mapping(x, y) 处的双线性插值，
+// 越界位置按填充方式取边缘或镜像像素
+func remap(img image.Image, w, h int, mapping func(x, y int) (float64, float64), fill FillMode) *image.NRGBA {
+	src := imaging.Clone(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := mapping(x, y)
+
+			x0, y0 := math.Floor(sx), math.Floor(sy)
+			fx, fy := sx-x0, sy-y0
+			xs := [2]int{boundaryIndex(int(x0), sw, fill), boundaryIndex(int(x0)+1, sw, fill)}
+			ys := [2]int{boundaryIndex(int(y0), sh, fill), boundaryIndex(int(y0)+1, sh, fill)}
+			wx := [2]float64{1 - fx, fx}
+			wy := [2]float64{1 - fy, fy}
+
+			// 按透明度加权插值，避免透明像素的颜色渗入
+			var r, g, bl, a float64
+			for j := 0; j < 2; j++ {
+				for i := 0; i < 2; i++ {
+					weight := wx[i] * wy[j]
+					if weight == 0 {
+						continue
+					}
+					p := src.Pix[ys[j]*src.Stride+xs[i]*4:]
+					pa := float64(p[3]) * weight
+					r += float64(p[0]) * pa
+					g += float64(p[1]) * pa
+					bl += float64(p[2]) * pa
+					a += pa
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4:]
+			if a > 0 {
+				d[0] = clampUint8(r / a)
+				d[1] = clampUint8(g / a)
+				d[2] = clampUint8(bl / a)
+				d[3] = clampUint8(a)
+			}
+		}
+	}
+	return dst
+}
+
+// selectLines 新图片的第 y 行第 x 列取源图第 rows[y] 行第 cols[x] 列的像素
+func selectLines(img image.Image, rows, cols []int) *image.NRGBA {
+	src := imaging.Clone(img)
+	dst := image.NewNRGBA(image.Rect(0, 0, len(cols), len(rows)))
+	for y, sy := range rows {
+		line := src.Pix[sy*src.Stride:]
+		out := dst.Pix[y*dst.Stride:]
+		for x, sx := range cols {
+			copy(out[4*x:4*x+4], line[4*sx:4*sx+4])
+		}
+	}
+	return dst
+}
+
+// boundaryIndex 将越界坐标映射回 [0, n)
+func boundaryIndex(i, n int, fill FillMode) int {
+	if i >= 0 && i < n {
+		return i
+	}
+	if fill == FillMirror && n > 1 {
+		period := 2 * n
+		i %= period
+		if i < 0 {
+			i += period
+		}
+		if i >= n {
+			i = period - 1 - i
+		}
+		return i
+	}
+	if i < 0 {
+		return 0
+	}
+	return n - 1
+}
+
+// inscribedSize 计算 w×h 的图片旋转 angle 度后，完全落在图像内容内的最大轴对齐矩形尺寸
+func inscribedSize(w, h int, angle float64) (int, int) {
+	sin, cos := math.Sincos(math.Pi * angle / 180)
+	sin, cos = math.Abs(sin), math.Abs(cos)
+	fw, fh := float64(w), float64(h)
+	long, short := math.Max(fw, fh), math.Min(fw, fh)
+
+	var cw, ch float64
+	if short <= 2*sin*cos*long || math.Abs(sin-cos) < 1e-10 {
+		// 内接矩形的两个顶点落在长边上
+		half := 0.5 * short
+		if fw >= fh {
+			cw, ch = half/sin, half/cos
+		} else {
+			cw, ch = half/cos, half/sin
+		}
+	} else {
+		cos2 := cos*cos - sin*sin
+		cw, ch = (fw*cos-fh*sin)/cos2, (fh*cos-fw*sin)/cos2
+	}
+
+	return max(1, min(w, int(cw))), max(1, min(h, int(ch)))
+}
+
+func clampUint8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/Neurocoda/Antimg/codec"
+)
+
+// brightPNG 生成亮色渐变的 PNG，transparent 时中心区域为完全透明，边缘保持不透明
+func brightPNG(t *testing.T, w, h int, transparent bool) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := uint8(255)
+			if transparent && x > w/3 && x < 2*w/3 && y > h/3 && y < 2*h/3 {
+				a = 0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(180 + x%60), uint8(200 + y%50), 220, a})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 不透明图片或输出格式不支持透明度时，旋转默认镜像填充，JPEG 输出的角落不会变黑
+func TestRotateDefaultFill(t *testing.T) {
+	service := NewImageService(0, PixelLimit{})
+	seed := int64(3)
+	rotateOnly := Pipeline{{Name: "geometric", Params: StageParams{"scale": 0}}}
+
+	corners := func(img image.Image) []color.NRGBA {
+		b := img.Bounds()
+		var cs []color.NRGBA
+		for _, p := range []image.Point{{b.Min.X, b.Min.Y}, {b.Max.X - 1, b.Min.Y}, {b.Min.X, b.Max.Y - 1}, {b.Max.X - 1, b.Max.Y - 1}} {
+			cs = append(cs, color.NRGBAModel.Convert(img.At(p.X, p.Y)).(color.NRGBA))
+		}
+		return cs
+	}
+	process := func(t *testing.T, data []byte, format string) image.Image {
+		t.Helper()
+		result, err := service.ProcessImage(context.Background(), bytes.NewReader(data), ProcessOptions{
+			AttackLevel: 1,
+			Pipeline:    rotateOnly,
+			Seed:        &seed,
+			SkipMetrics: true,
+			Output:      codec.Options{Format: format},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := codec.Encode(&buf, result.Output.OutputFormat(result.Format), result.Image, result.Output); err != nil {
+			t.Fatal(err)
+		}
+		img, _, _, err := codec.Decode(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+
+	for _, tc := range []struct {
+		name        string
+		transparent bool
+		format      string
+	}{
+		{"opaque-jpeg", false, "jpeg"},
+		{"opaque-png", false, "png"},
+		{"alpha-jpeg", true, "jpeg"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := process(t, brightPNG(t, 96, 64, tc.transparent), tc.format)
+			for _, c := range corners(out) {
+				if c.A != 255 || int(c.R)+int(c.G)+int(c.B) < 300 {
+					t.Errorf("角落像素 %v, 期望亮色不透明像素", c)
+				}
+			}
+		})
+	}
+
+	// 带透明度且输出格式支持透明度时仍默认透明填充
+	out := process(t, brightPNG(t, 96, 64, true), "png")
+	for _, c := range corners(out) {
+		if c.A != 0 {
+			t.Errorf("透明图片的角落 %v, 期望透明", c)
+		}
+	}
+}
@@ -1,284 +1,268 @@
 package services
 
 import (
-	"bytes"
 	"context"
+	crand "crypto/rand"
+	"encoding/binary"
 	"errors"
 	"image"
-	"image/color"
-	"image/jpeg"
 	"io"
 	"math/rand"
 	"time"
 
-	"github.com/disintegration/imaging"
-	_ "golang.org/x/image/bmp"
-	_ "golang.org/x/image/webp"
-	_ "image/png"
+	"github.com/Neurocoda/Antimg/codec"
+	"github.com/Neurocoda/Antimg/metrics"
 )
 
+// ImageService 图片处理服务，可被多个请求并发使用
+// 服务本身不持有随机数生成器，每次处理都基于种子创建独立的随机源
 type ImageService struct {
-	rng *rand.Rand
+	timeout time.Duration // 单次处理超时时间，0 表示不限制
+	limit   PixelLimit    // 输入图片的像素数限制
 }
 
-func NewImageService() *ImageService {
-	// Use new random number generator API
+func NewImageService(timeout time.Duration, limit PixelLimit) *ImageService {
 	return &ImageService{
-		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+		timeout: timeout,
+		limit:   limit,
 	}
 }
 
-// ProcessImage 处理上传的图片，带超时控制
-func (s *ImageService) ProcessImage(src io.Reader, attackLevel float64) (image.Image, string, error) {
-	// 创建带超时的上下文 (30秒超时)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// 使用通道来处理超时
-	type result struct {
-		img    image.Image
-		format string
-		err    error
-	}
+// ErrProcessTimeout 处理超时
+var ErrProcessTimeout = errors.New("图片处理超时，请尝试较小的图片或降低攻击强度")
 
-	resultChan := make(chan result, 1)
+// ErrProcessCanceled 处理被取消（如客户端断开连接）
+var ErrProcessCanceled = errors.New("图片处理已取消")
 
-	go func() {
-		// 解码图片，同时获取格式信息
-		img, format, err := image.Decode(src)
-		if err != nil {
-			resultChan <- result{nil, "", err}
-			return
-		}
-
-		// 执行水印攻击
-		processedImg := s.attackWatermark(img, attackLevel)
-		resultChan <- result{processedImg, format, nil}
-	}()
-
-	// 等待结果或超时
-	select {
-	case res := <-resultChan:
-		return res.img, res.format, res.err
-	case <-ctx.Done():
-		return nil, "", errors.New("图片处理超时，请尝试较小的图片或降低攻击强度")
+// newSeed 生成随机种子，crypto/rand 可安全地被并发调用
+func newSeed() int64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return time.Now().UnixNano()
 	}
+	return int64(binary.LittleEndian.Uint64(b[:]) >> 1)
 }
 
-// attackWatermark 执行水印攻击算法
-func (s *ImageService) attackWatermark(img image.Image, attackLevel float64) image.Image {
-	// 强化攻击算法 - 多轮攻击
-	result := img
-
-	// 第一轮：强力几何攻击
-	result = s.applyAggressiveGeometricAttack(result, attackLevel)
+// ProcessOptions 单次处理的参数
+type ProcessOptions struct {
+	AttackLevel float64
+	Pipeline    Pipeline       // 为空时使用默认处理流程
+	Seed        *int64         // 随机种子，为空时随机生成
+	Output      codec.Options  // 输出编码参数，原样传递到处理结果
+	SkipMetrics bool           // 不计算质量指标，可节省大图的处理时间
+	Target      *QualityTarget // 质量目标，非空时忽略 AttackLevel，自动搜索满足目标的最强攻击强度
 
-	// 第二轮：强力噪声攻击
-	result = s.applyAggressiveNoiseAttack(result, attackLevel)
-
-	// 第三轮：强力频域攻击
-	result = s.applyAggressiveFrequencyAttack(result, attackLevel)
-
-	// 第四轮：强力压缩攻击
-	result = s.applyAggressiveCompressionAttack(result, attackLevel)
-
-	// 第五轮：强力颜色攻击
-	result = s.applyAggressiveColorAttack(result, attackLevel)
+	Progress func(completed, total int) // 阶段进度回调，可为空
+}
 
-	// 最终轮：混合攻击
-	if attackLevel > 0.7 {
-		result = s.applyFinalMixedAttack(result, attackLevel)
+// resolve 返回实际使用的处理流程和随机种子，未指定时使用默认流程和随机种子
+func (opts ProcessOptions) resolve() (Pipeline, int64) {
+	pipeline := opts.Pipeline
+	if len(pipeline) == 0 {
+		pipeline = DefaultPipeline()
 	}
-
-	return result
+	if opts.Seed != nil {
+		return pipeline, *opts.Seed
+	}
+	return pipeline, newSeed()
 }
 
-// applyAggressiveNoiseAttack 强力噪声攻击
-func (s *ImageService) applyAggressiveNoiseAttack(img image.Image, level float64) image.Image {
-	result := imaging.Clone(img)
-
-	// 强力亮度攻击
-	brightnessChange := (s.rng.Float64() - 0.5) * level * 60 // 最大±30亮度变化
-	result = imaging.AdjustBrightness(result, brightnessChange)
-
-	// 强力对比度攻击
-	contrastChange := (s.rng.Float64() - 0.5) * level * 80 // 最大±40对比度变化
-	result = imaging.AdjustContrast(result, contrastChange)
-
-	// 多次随机调整
-	rounds := int(level*3) + 1
-	for i := 0; i < rounds; i++ {
-		brightness := (s.rng.Float64() - 0.5) * level * 20
-		contrast := (s.rng.Float64() - 0.5) * level * 30
-		result = imaging.AdjustBrightness(result, brightness)
-		result = imaging.AdjustContrast(result, contrast)
-	}
+// ProcessResult 处理结果
+type ProcessResult struct {
+	Image   image.Image
+	Format  string
+	Seed    int64 // 实际使用的随机种子，可用于复现结果
+	Output  codec.Options
+	Metrics *metrics.Result // 处理结果相对解码后输入的质量指标，跳过计算时为 nil
 
-	return result
+	AttackLevel float64 // 实际使用的攻击强度，自适应模式下为搜索结果
+	TargetMet   *bool   // 自适应模式下是否达到了质量目标，其他模式为 nil
 }
 
-// applyAggressiveFrequencyAttack 强力频域攻击
-func (s *ImageService) applyAggressiveFrequencyAttack(img image.Image, level float64) image.Image {
-	result := img
+// ProcessImage 处理上传的图片，ctx 结束或超时后所有阶段都会尽快停止
+// 相同的输入、强度、处理流程和种子总是得到相同的输出
+func (s *ImageService) ProcessImage(ctx context.Context, src io.Reader, opts ProcessOptions) (*ProcessResult, error) {
+	pipeline, seed := opts.resolve()
 
-	// 强力模糊攻击
-	blurRadius := level * 3.0 // 大幅增加模糊半径
-	if blurRadius > 0.5 {
-		result = imaging.Blur(result, blurRadius)
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
 	}
 
-	// 强力锐化攻击
-	if level > 0.3 {
-		sharpenAmount := level * 5.0 // 大幅增加锐化强度
-		result = imaging.Sharpen(result, sharpenAmount)
+	img, format, meta, err := s.decodeInput(ctx, src)
+	if err != nil {
+		return nil, err
 	}
 
-	// 交替模糊和锐化
-	rounds := int(level*2) + 1
-	for i := 0; i < rounds; i++ {
-		if i%2 == 0 {
-			result = imaging.Blur(result, level*2.0)
-		} else {
-			result = imaging.Sharpen(result, level*3.0)
-		}
+	output := opts.Output
+	if output.MetadataPolicy == "" {
+		output.MetadataPolicy = codec.MetadataStrip
+	}
+	img, output.ICCMode = convertColorSpace(img, meta.ICC, output.OutputFormat(format), output)
+
+	// 执行水印攻击，阶段按实际输出格式选择默认的旋转填充方式
+	opts.Output.Format = output.OutputFormat(format)
+	attacked, err := s.runAttack(ctx, img, opts, pipeline, seed)
+	if err != nil {
+		return nil, wrapContextError(ctx, err)
 	}
 
-	// 最终强力模糊
-	if level > 0.7 {
-		result = imaging.Blur(result, level*4.0)
+	output.Metadata = meta.Apply(output.MetadataPolicy)
+	if output.ICCMode == codec.ICCEmbed {
+		output.Metadata.ICC = meta.ICC
+	} else {
+		output.Metadata.ICC = nil
 	}
 
-	return result
+	return &ProcessResult{
+		Image:       attacked.image,
+		Format:      format,
+		Seed:        seed,
+		Output:      output,
+		Metrics:     attacked.metrics,
+		AttackLevel: attacked.level,
+		TargetMet:   attacked.met,
+	}, nil
 }
 
-// applyAggressiveGeometricAttack 强力几何攻击
-func (s *ImageService) applyAggressiveGeometricAttack(img image.Image, level float64) image.Image {
-	bounds := img.Bounds()
-	result := img
+// attackOutcome 单次攻击的结果
+type attackOutcome struct {
+	image   image.Image
+	level   float64         // 实际使用的攻击强度
+	metrics *metrics.Result // 相对攻击前图片的质量指标，跳过计算时为 nil
+	met     *bool           // 自适应模式下是否达到了质量目标，其他模式为 nil
+}
 
-	// 强力旋转攻击
-	if level > 0.2 {
-		angle := (s.rng.Float64() - 0.5) * level * 15 // 大幅增加旋转角度
-		result = imaging.Rotate(result, angle, color.Transparent)
+// runAttack 按固定强度执行攻击，或在设置了质量目标时搜索满足目标的最强攻击强度
+func (s *ImageService) runAttack(ctx context.Context, img image.Image, opts ProcessOptions, pipeline Pipeline, seed int64) (*attackOutcome, error) {
+	if opts.Target != nil {
+		found, err := s.searchAttackLevel(ctx, img, opts, pipeline, seed)
+		if err != nil {
+			return nil, err
+		}
+		return &attackOutcome{image: found.image, level: found.level, metrics: &found.metrics, met: &found.met}, nil
 	}
 
-	// 强力缩放攻击
-	if level > 0.3 {
-		scaleFactor := 1.0 + (s.rng.Float64()-0.5)*level*0.2 // 大幅增加缩放范围
-		newWidth := int(float64(bounds.Dx()) * scaleFactor)
-		newHeight := int(float64(bounds.Dy()) * scaleFactor)
-		result = imaging.Resize(result, newWidth, newHeight, imaging.Lanczos)
-		// 裁剪回原始大小
-		result = imaging.CropCenter(result, bounds.Dx(), bounds.Dy())
+	out, err := s.attackWatermark(ctx, img, opts, pipeline, seed)
+	if err != nil {
+		return nil, err
 	}
+	outcome := &attackOutcome{image: out, level: opts.AttackLevel}
+	if !opts.SkipMetrics {
+		// 在输出编码之前比较，反映各处理阶段造成的损伤
+		m := metrics.Compare(img, out)
+		outcome.metrics = &m
+	}
+	return outcome, nil
+}
 
-	// 多轮几何变换
-	rounds := int(level*3) + 1
-	for i := 0; i < rounds; i++ {
-		// 随机旋转
-		angle := (s.rng.Float64() - 0.5) * level * 8
-		result = imaging.Rotate(result, angle, color.Transparent)
-
-		// 随机缩放
-		scale := 1.0 + (s.rng.Float64()-0.5)*level*0.1
-		newW := int(float64(bounds.Dx()) * scale)
-		newH := int(float64(bounds.Dy()) * scale)
-		result = imaging.Resize(result, newW, newH, imaging.Lanczos)
-		result = imaging.CropCenter(result, bounds.Dx(), bounds.Dy())
+// decodeInput 读取并解码输入图片，像素按 EXIF 方向校正
+// 完整解码前先读取头部尺寸，拒绝超过像素数限制的图片，或在解码后缩小到限制以内
+func (s *ImageService) decodeInput(ctx context.Context, src io.Reader) (image.Image, string, codec.Metadata, error) {
+	data, err := io.ReadAll(&ctxReader{ctx: ctx, r: src})
+	if err != nil {
+		return nil, "", codec.Metadata{}, wrapContextError(ctx, err)
 	}
 
-	// 最终强力变换
-	if level > 0.8 {
-		finalAngle := (s.rng.Float64() - 0.5) * level * 20
-		result = imaging.Rotate(result, finalAngle, color.Transparent)
+	cfg, _, err := codec.DecodeConfig(data)
+	if err != nil {
+		return nil, "", codec.Metadata{}, err
+	}
+	downscale, err := s.limit.check(cfg)
+	if err != nil {
+		return nil, "", codec.Metadata{}, err
 	}
 
-	return result
+	img, format, meta, err := codec.Decode(data)
+	if err != nil {
+		return nil, "", codec.Metadata{}, wrapContextError(ctx, err)
+	}
+	if downscale {
+		img = s.limit.fit(img)
+	}
+	return img, format, meta, nil
 }
 
-// applyAggressiveCompressionAttack 强力压缩攻击
-func (s *ImageService) applyAggressiveCompressionAttack(img image.Image, level float64) image.Image {
-	// 根据攻击等级调整JPEG质量 - 更激进
-	quality := 100 - int(level*60) // 质量从100降到40
-	if quality < 30 {
-		quality = 30
+// CompareImages 计算 processed 相对 reference 的质量指标，两者都按 ICC 配置文件转换到 sRGB 后比较
+func (s *ImageService) CompareImages(ctx context.Context, reference, processed io.Reader) (*metrics.Result, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
 	}
 
-	// 多轮压缩攻击
-	result := img
-	compressionRounds := int(level*5) + 1 // 最多6轮压缩
-
-	for i := 0; i < compressionRounds; i++ {
-		// 每轮都降低质量
-		currentQuality := quality - i*5
-		if currentQuality < 20 {
-			currentQuality = 20
-		}
-
-		var buf bytes.Buffer
-		jpeg.Encode(&buf, result, &jpeg.Options{Quality: currentQuality})
-
-		// 解码回图片
-		decodedImg, err := jpeg.Decode(&buf)
+	var imgs [2]image.Image
+	for i, src := range []io.Reader{reference, processed} {
+		img, _, meta, err := s.decodeInput(ctx, src)
 		if err != nil {
-			return img // 如果失败，返回原图
+			return nil, err
+		}
+		if p, err := codec.ParseICC(meta.ICC); err == nil {
+			img = p.ToSRGB(img)
 		}
-		result = decodedImg
+		imgs[i] = img
 	}
 
-	return result
+	m := metrics.Compare(imgs[0], imgs[1])
+	return &m, nil
 }
 
-// applyAggressiveColorAttack 强力颜色攻击
-func (s *ImageService) applyAggressiveColorAttack(img image.Image, level float64) image.Image {
-	result := img
-
-	// 强力亮度和对比度攻击
-	rounds := int(level*4) + 1
-	for i := 0; i < rounds; i++ {
-		brightnessChange := (s.rng.Float64() - 0.5) * level * 50 // 大幅增加亮度变化
-		contrastChange := (s.rng.Float64() - 0.5) * level * 60   // 大幅增加对比度变化
-		result = imaging.AdjustBrightness(result, brightnessChange)
-		result = imaging.AdjustContrast(result, contrastChange)
+// convertColorSpace 确定 ICC 配置文件的处理方式并准备工作色彩空间：
+// 嵌入时以原配置文件的色彩空间作为工作空间，各阶段直接处理原始像素；
+// 转换时先将像素转换到 sRGB，之后的颜色和噪声阶段都在 sRGB 下进行
+func convertColorSpace(img image.Image, profile []byte, format string, output codec.Options) (image.Image, codec.ICCMode) {
+	mode := codec.ResolveICCMode(output.ICCMode, profile, format, output.MetadataPolicy)
+	if mode != codec.ICCSRGB {
+		return img, mode
 	}
-
-	return result
+	p, err := codec.ParseICC(profile)
+	if err != nil {
+		return img, codec.ICCNone
+	}
+	return p.ToSRGB(img), mode
 }
 
-// applyFinalMixedAttack 最终混合攻击
-func (s *ImageService) applyFinalMixedAttack(img image.Image, level float64) image.Image {
-	result := img
-
-	// 最终破坏性攻击组合
-	for i := 0; i < 3; i++ {
-		// 强力模糊
-		result = imaging.Blur(result, level*5.0)
-
-		// 强力锐化
-		result = imaging.Sharpen(result, level*6.0)
+// wrapContextError 将上下文结束导致的错误转换为超时或取消错误
+func wrapContextError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return ErrProcessTimeout
+	case context.Canceled:
+		return ErrProcessCanceled
+	}
+	return err
+}
 
-		// 强力亮度对比度调整
-		brightness := (s.rng.Float64() - 0.5) * level * 40
-		contrast := (s.rng.Float64() - 0.5) * level * 50
-		result = imaging.AdjustBrightness(result, brightness)
-		result = imaging.AdjustContrast(result, contrast)
+// ctxReader 在上下文结束后中断读取，避免继续解码
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
 
-		// 旋转攻击
-		angle := (s.rng.Float64() - 0.5) * level * 10
-		result = imaging.Rotate(result, angle, color.Transparent)
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
 
-		// 压缩攻击
-		quality := 50 - int(level*30)
-		if quality < 15 {
-			quality = 15
-		}
-		var buf bytes.Buffer
-		jpeg.Encode(&buf, result, &jpeg.Options{Quality: quality})
-		decodedImg, err := jpeg.Decode(&buf)
-		if err == nil {
-			result = decodedImg
-		}
+// attackWatermark 按处理流程执行水印攻击算法
+// math/rand.Rand 不是并发安全的，因此每次调用都创建仅属于当前请求的随机源
+// 带透明度的图片先分离透明度通道，各阶段只攻击颜色通道，处理完成后再合并
+func (s *ImageService) attackWatermark(ctx context.Context, img image.Image, opts ProcessOptions, pipeline Pipeline, seed int64) (image.Image, error) {
+	colorImg, alpha := splitAlpha(img)
+	env := &StageEnv{
+		Ctx:      ctx,
+		Rng:      rand.New(rand.NewSource(seed)),
+		Progress: opts.Progress,
+		alpha:    alpha,
+		fill:     defaultFill(alpha != nil, opts.Output.Format),
 	}
 
-	return result
+	result, err := pipeline.Run(env, colorImg, opts.AttackLevel)
+	if err != nil {
+		return nil, err
+	}
+	return mergeAlpha(result, env.alpha), nil
 }
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"sync"
+	"testing"
+)
+
+// encodePNG 生成 w×h 的渐变测试图片并编码为 PNG
+func encodePNG(t testing.TB, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 7), uint8(y * 5), uint8((x + y) * 3), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 极小图片经过缩放类阶段后不能变为空图片，质量指标计算也不能崩溃
+func TestProcessImageTinyInputs(t *testing.T) {
+	service := NewImageService(0, PixelLimit{})
+	for _, size := range []int{1, 2} {
+		data := encodePNG(t, size, size)
+		for _, level := range []float64{0.5, 1} {
+			seed := int64(1)
+			result, err := service.ProcessImage(context.Background(), bytes.NewReader(data), ProcessOptions{AttackLevel: level, Seed: &seed})
+			if err != nil {
+				t.Fatalf("%dx%d level=%v: %v", size, size, level, err)
+			}
+			if result.Image.Bounds().Empty() {
+				t.Errorf("%dx%d level=%v: 输出为空图片", size, size, level)
+			}
+			if result.Metrics == nil {
+				t.Errorf("%dx%d level=%v: 缺少质量指标", size, size, level)
+			}
+		}
+	}
+}
+
+// allStagesPipeline 依次包含所有已注册阶段（测试用的 panic 阶段除外）的处理流程
+func allStagesPipeline() Pipeline {
+	var pipeline Pipeline
+	for _, name := range StageNames() {
+		if name != "test-panic" {
+			pipeline = append(pipeline, StageConfig{Name: name})
+		}
+	}
+	return pipeline
+}
+
+// processPNG 按种子处理图片，返回编码为 PNG 的结果
+func processPNG(service *ImageService, data []byte, pipeline Pipeline, seed int64) ([]byte, error) {
+	result, err := service.ProcessImage(context.Background(), bytes.NewReader(data), ProcessOptions{
+		AttackLevel: 0.6,
+		Pipeline:    pipeline,
+		Seed:        &seed,
+		SkipMetrics: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, result.Image); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 并发处理时各请求使用独立的随机源，相同种子的结果与单独处理时逐字节一致（配合 -race 运行）
+func TestProcessImageConcurrentDeterministic(t *testing.T) {
+	service := NewImageService(0, PixelLimit{})
+	data := encodePNG(t, 48, 40)
+
+	for _, tc := range []struct {
+		name     string
+		pipeline Pipeline
+	}{
+		{"default", nil},
+		{"all-stages", allStagesPipeline()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			const seeds = 4
+			want := make([][]byte, seeds)
+			for i := range want {
+				out, err := processPNG(service, data, tc.pipeline, int64(i+1))
+				if err != nil {
+					t.Fatal(err)
+				}
+				want[i] = out
+			}
+			if bytes.Equal(want[0], want[1]) {
+				t.Fatal("不同种子的输出应不同")
+			}
+
+			// 每个种子同时由多个 goroutine 处理
+			var wg sync.WaitGroup
+			errs := make(chan error, seeds*3)
+			for round := 0; round < 3; round++ {
+				for i := 0; i < seeds; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						out, err := processPNG(service, data, tc.pipeline, int64(i+1))
+						if err != nil {
+							errs <- err
+							return
+						}
+						if !bytes.Equal(out, want[i]) {
+							t.Errorf("seed=%d: 并发处理的输出与单独处理不一致", i+1)
+						}
+					}(i)
+				}
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
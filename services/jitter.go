@@ -0,0 +1,81 @@
+package services
+
+import (
+	"image"
+	"math"
+	"math/rand"
+)
+
+func init() {
+	RegisterStage(jitterStage{})
+}
+
+// jitterStage 行列抖动攻击：随机删除或重复少量行和列，再缩放回原尺寸，
+// 使像素位置产生不均匀的错位，破坏 DCT 类水印依赖的块对齐，画面几乎没有可见变化
+// 参数: density 强度为1时受影响的行列比例（默认0.02），rows 行方向倍数，cols 列方向倍数（0 表示不处理）
+type jitterStage struct{}
+
+func (jitterStage) Name() string { return "jitter" }
+
+func (jitterStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	density := level * params.Float("density", 0.02)
+	if density <= 0 {
+		return img, nil
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	rows := jitterLines(env.Rng, h, density*params.Float("rows", 1))
+	cols := jitterLines(env.Rng, w, density*params.Float("cols", 1))
+	if len(rows) == h && len(cols) == w && isIdentity(rows) && isIdentity(cols) {
+		return img, nil
+	}
+
+	result := env.SelectLines(img, rows, cols)
+	if len(rows) != h || len(cols) != w {
+		result = env.Resize(result, w, h)
+	}
+	return result, nil
+}
+
+// jitterLines 返回长度为 n 的方向上保留的行（列）索引：随机选出约 n×fraction 条，
+// 每条以相同概率删除或重复一次
+func jitterLines(rng *rand.Rand, n int, fraction float64) []int {
+	lines := make([]int, 0, n+int(float64(n)*fraction)+1)
+	if fraction <= 0 || n < 2 {
+		for i := 0; i < n; i++ {
+			lines = append(lines, i)
+		}
+		return lines
+	}
+
+	count := max(1, int(math.Round(float64(n)*fraction)))
+	action := make(map[int]bool, count) // true 重复，false 删除
+	for _, i := range rng.Perm(n)[:min(count, n)] {
+		action[i] = rng.Intn(2) == 0
+	}
+	for i := 0; i < n; i++ {
+		dup, chosen := action[i]
+		if chosen && !dup {
+			continue
+		}
+		lines = append(lines, i)
+		if dup {
+			lines = append(lines, i)
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, 0)
+	}
+	return lines
+}
+
+// isIdentity 索引是否恰好为 0..len-1
+func isIdentity(lines []int) bool {
+	for i, v := range lines {
+		if v != i {
+			return false
+		}
+	}
+	return true
+}
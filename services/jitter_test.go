@@ -0,0 +1,75 @@
+package services
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestJitterStage(t *testing.T) {
+	for _, size := range [][2]int{{120, 90}, {33, 7}, {2, 2}, {1, 1}} {
+		img := photoLike(size[0], size[1])
+		for _, level := range []float64{0.3, 1} {
+			a := applyStage(t, "jitter", img, level, StageParams{"density": 0.1}, 1)
+			if a.Bounds().Size() != img.Bounds().Size() {
+				t.Errorf("%v 强度 %v: 尺寸 %v", size, level, a.Bounds().Size())
+			}
+			if b := applyStage(t, "jitter", img, level, StageParams{"density": 0.1}, 1); !samePixels(a, b) {
+				t.Errorf("%v 强度 %v: 相同种子的结果不一致", size, level)
+			}
+		}
+	}
+
+	img := photoLike(120, 90)
+	if out := applyStage(t, "jitter", img, 0, nil, 1); !samePixels(out, img) {
+		t.Error("强度为0时图片应保持不变")
+	}
+	a := applyStage(t, "jitter", img, 1, nil, 1)
+	if samePixels(a, img) {
+		t.Error("强度为1时图片应被修改")
+	}
+	if b := applyStage(t, "jitter", img, 1, nil, 2); samePixels(a, b) {
+		t.Error("不同种子的结果相同")
+	}
+}
+
+// changedLines 统计被删除或重复的行（列）数
+func changedLines(lines []int, n int) int {
+	seen := make([]int, n)
+	for _, i := range lines {
+		seen[i]++
+	}
+	changed := 0
+	for _, c := range seen {
+		if c != 1 {
+			changed++
+		}
+	}
+	return changed
+}
+
+func TestJitterLinesGrowWithLevel(t *testing.T) {
+	const n = 1000
+	prev := 0
+	for _, level := range []float64{0.1, 0.25, 0.5, 1} {
+		fraction := level * 0.02
+		lines := jitterLines(rand.New(rand.NewSource(1)), n, fraction)
+		changed := changedLines(lines, n)
+		if want := int(math.Round(n * fraction)); changed != want {
+			t.Errorf("强度 %v: 改动 %d 行, 期望 %d", level, changed, want)
+		}
+		if changed <= prev {
+			t.Errorf("强度 %v: 改动 %d 行, 应多于较低强度的 %d 行", level, changed, prev)
+		}
+		prev = changed
+		for i := 1; i < len(lines); i++ {
+			if lines[i] < lines[i-1] {
+				t.Fatalf("强度 %v: 行顺序被打乱 %v", level, lines[i-1:i+1])
+			}
+		}
+	}
+
+	if lines := jitterLines(rand.New(rand.NewSource(1)), n, 0); len(lines) != n || !isIdentity(lines) {
+		t.Error("比例为0时应保留全部行")
+	}
+}
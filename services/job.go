@@ -0,0 +1,327 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Neurocoda/Antimg/codec"
+)
+
+// JobStatus 异步任务状态
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+var (
+	ErrJobNotFound  = errors.New("任务不存在")
+	ErrJobQueueFull = errors.New("任务队列已满，请稍后重试")
+	ErrJobNotReady  = errors.New("任务尚未完成")
+)
+
+// JobInfo 任务状态快照，可直接序列化返回给客户端
+type JobInfo struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"-"`
+	Filename  string    `json:"filename"` // 上传的原始文件名
+	Status    JobStatus `json:"status"`
+	Progress  float64   `json:"progress"` // 0.0-1.0
+	Error     string    `json:"error,omitempty"`
+	Seed      int64     `json:"seed"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JobResult 已完成任务的处理结果，只保留编码后的图片，不保留解码后的像素
+type JobResult struct {
+	ProcessResult        // 处理信息，Image 字段为 nil
+	Data          []byte // 按 Output 参数编码后的图片
+}
+
+// job 任务内部状态，所有字段由 JobManager.mutex 保护
+type job struct {
+	info   JobInfo
+	data   []byte // 上传的原始图片，开始处理后释放
+	opts   ProcessOptions
+	result *JobResult
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// finished 任务是否已结束
+func (j *job) finished() bool {
+	switch j.info.Status {
+	case JobCompleted, JobFailed, JobCanceled:
+		return true
+	}
+	return false
+}
+
+// JobManager 异步任务管理器，使用固定数量的worker执行处理流程
+type JobManager struct {
+	service *ImageService
+	queue   chan *job
+	jobs    map[string]*job
+	mutex   sync.RWMutex
+	ttl     time.Duration // 已结束任务的保留时间
+
+	maxResultBytes int64 // 保留结果的总字节数上限，0 表示不限制
+	resultBytes    int64 // 当前保留结果的总字节数
+}
+
+// NewJobManager 创建任务管理器并启动worker和过期任务清理；
+// 保留结果的总大小超过 maxResultBytes 时，最早完成的任务会被提前删除
+func NewJobManager(service *ImageService, workers, queueSize int, ttl time.Duration, maxResultBytes int64) *JobManager {
+	m := &JobManager{
+		service:        service,
+		queue:          make(chan *job, queueSize),
+		jobs:           make(map[string]*job),
+		ttl:            ttl,
+		maxResultBytes: maxResultBytes,
+	}
+
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+	go m.cleanupLoop()
+
+	return m
+}
+
+// Submit 提交任务，队列已满时返回 ErrJobQueueFull，图片尺寸超过限制时返回 *ImageTooLargeError
+func (m *JobManager) Submit(owner, filename string, data []byte, opts ProcessOptions) (JobInfo, error) {
+	if err := m.service.CheckSize(data); err != nil {
+		return JobInfo{}, err
+	}
+
+	// 提交时确定种子，便于客户端复现结果
+	if opts.Seed == nil {
+		seed := newSeed()
+		opts.Seed = &seed
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	j := &job{
+		info: JobInfo{
+			ID:        newJobID(),
+			Owner:     owner,
+			Filename:  filename,
+			Status:    JobQueued,
+			Seed:      *opts.Seed,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		data:   data,
+		opts:   opts,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	select {
+	case m.queue <- j:
+	default:
+		cancel()
+		return JobInfo{}, ErrJobQueueFull
+	}
+
+	m.jobs[j.info.ID] = j
+	return j.info, nil
+}
+
+// Get 获取任务状态
+func (m *JobManager) Get(id string) (JobInfo, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	j, exists := m.jobs[id]
+	if !exists {
+		return JobInfo{}, ErrJobNotFound
+	}
+	return j.info, nil
+}
+
+// Result 获取已完成任务的处理结果
+func (m *JobManager) Result(id string) (*JobResult, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	j, exists := m.jobs[id]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	if j.info.Status != JobCompleted {
+		return nil, ErrJobNotReady
+	}
+	return j.result, nil
+}
+
+// Cancel 取消排队中或运行中的任务；已结束的任务直接删除并释放结果
+func (m *JobManager) Cancel(id string) (JobInfo, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	j, exists := m.jobs[id]
+	if !exists {
+		return JobInfo{}, ErrJobNotFound
+	}
+
+	if j.finished() {
+		m.remove(j)
+		return j.info, nil
+	}
+
+	j.cancel()
+	j.data = nil
+	j.info.Status = JobCanceled
+	j.info.UpdatedAt = time.Now()
+	return j.info, nil
+}
+
+// worker 从队列中取出任务并执行
+func (m *JobManager) worker() {
+	for j := range m.queue {
+		m.run(j)
+	}
+}
+
+func (m *JobManager) run(j *job) {
+	m.mutex.Lock()
+	if j.info.Status != JobQueued {
+		// 排队期间已被取消
+		m.mutex.Unlock()
+		return
+	}
+	data := j.data
+	j.data = nil
+	j.info.Status = JobRunning
+	j.info.UpdatedAt = time.Now()
+	m.mutex.Unlock()
+
+	opts := j.opts
+	opts.Progress = func(completed, total int) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		j.info.Progress = float64(completed) / float64(total)
+		j.info.UpdatedAt = time.Now()
+	}
+
+	result, err := m.process(j.ctx, data, opts)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	j.cancel()
+	j.info.UpdatedAt = time.Now()
+	if j.info.Status == JobCanceled {
+		return
+	}
+	if err != nil {
+		j.info.Status = JobFailed
+		j.info.Error = err.Error()
+		return
+	}
+	j.result = result
+	j.info.Status = JobCompleted
+	j.info.Progress = 1
+	m.resultBytes += int64(len(result.Data))
+	m.evictResults(j)
+}
+
+// errJobPanic 处理过程中发生 panic 时记录在任务上的错误
+var errJobPanic = errors.New("图片处理失败: 内部错误")
+
+// process 执行处理并编码结果，worker 中的 panic 无法被 HTTP 中间件捕获，需在此恢复并记为任务失败
+func (m *JobManager) process(ctx context.Context, data []byte, opts ProcessOptions) (result *JobResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("异步任务处理 panic: %v\n%s", r, debug.Stack())
+			result, err = nil, errJobPanic
+		}
+	}()
+
+	processed, err := m.service.ProcessImage(ctx, bytes.NewReader(data), opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, processed.Output.OutputFormat(processed.Format), processed.Image, processed.Output); err != nil {
+		return nil, errors.New("图片编码失败: " + err.Error())
+	}
+
+	result = &JobResult{ProcessResult: *processed, Data: buf.Bytes()}
+	result.Image = nil
+	return result, nil
+}
+
+// remove 删除任务并释放其结果占用的额度，调用方需持有写锁
+func (m *JobManager) remove(j *job) {
+	if j.result != nil {
+		m.resultBytes -= int64(len(j.result.Data))
+	}
+	delete(m.jobs, j.info.ID)
+}
+
+// evictResults 保留结果超过总大小上限时，从最早完成的任务开始删除，直到回到上限以内；
+// 刚完成的任务 keep 不会被删除。调用方需持有写锁
+func (m *JobManager) evictResults(keep *job) {
+	if m.maxResultBytes <= 0 || m.resultBytes <= m.maxResultBytes {
+		return
+	}
+
+	completed := make([]*job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		if j.result != nil && j != keep {
+			completed = append(completed, j)
+		}
+	}
+	sort.Slice(completed, func(a, b int) bool {
+		return completed[a].info.UpdatedAt.Before(completed[b].info.UpdatedAt)
+	})
+	for _, j := range completed {
+		if m.resultBytes <= m.maxResultBytes {
+			break
+		}
+		m.remove(j)
+	}
+}
+
+// cleanupLoop 定期删除超过保留时间的已结束任务
+func (m *JobManager) cleanupLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.mutex.Lock()
+		now := time.Now()
+		for _, j := range m.jobs {
+			if j.finished() && now.Sub(j.info.UpdatedAt) > m.ttl {
+				m.remove(j)
+			}
+		}
+		m.mutex.Unlock()
+	}
+}
+
+// newJobID 生成随机任务ID
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// panicStage 执行时 panic 的测试阶段
+type panicStage struct{}
+
+func (panicStage) Name() string { return "test-panic" }
+
+func (panicStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	panic("test panic")
+}
+
+func init() {
+	RegisterStage(panicStage{})
+}
+
+// waitJob 等待任务结束并返回最终状态
+func waitJob(t *testing.T, m *JobManager, id string) JobInfo {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		info, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch info.Status {
+		case JobCompleted, JobFailed, JobCanceled:
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("等待任务结束超时")
+	return JobInfo{}
+}
+
+func TestJobPanicMarksFailed(t *testing.T) {
+	m := NewJobManager(NewImageService(0, PixelLimit{}), 1, 4, time.Hour, 0)
+
+	info, err := m.Submit("test", "a.png", encodePNG(t, 8, 8), ProcessOptions{Pipeline: Pipeline{{Name: "test-panic"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info = waitJob(t, m, info.ID); info.Status != JobFailed || info.Error == "" {
+		t.Fatalf("panic 的任务应标记为失败: %+v", info)
+	}
+
+	// worker 在 panic 后仍能继续处理任务
+	info, err = m.Submit("test", "a.png", encodePNG(t, 8, 8), ProcessOptions{AttackLevel: 0.2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info = waitJob(t, m, info.ID); info.Status != JobCompleted {
+		t.Fatalf("后续任务应正常完成: %+v", info)
+	}
+}
+
+func TestJobResultEviction(t *testing.T) {
+	// 上限小于单个结果，每个任务完成时都会删除之前完成的任务
+	m := NewJobManager(NewImageService(0, PixelLimit{}), 1, 4, time.Hour, 1)
+
+	// 只使用保持尺寸的阶段，便于检查结果
+	opts := ProcessOptions{AttackLevel: 0.2, Pipeline: Pipeline{{Name: "noise"}}}
+	var ids []string
+	for i := 0; i < 2; i++ {
+		info, err := m.Submit("test", "a.png", encodePNG(t, 16, 16), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info = waitJob(t, m, info.ID); info.Status != JobCompleted {
+			t.Fatalf("任务应正常完成: %+v", info)
+		}
+		ids = append(ids, info.ID)
+	}
+
+	if _, err := m.Get(ids[0]); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("超出上限时最早完成的任务应被删除，err = %v", err)
+	}
+	result, err := m.Result(ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Image != nil {
+		t.Error("任务结果不应保留解码后的图片")
+	}
+	img, err := png.Decode(bytes.NewReader(result.Data))
+	if err != nil {
+		t.Fatalf("保存的结果无法解码: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 16 {
+		t.Errorf("结果尺寸 = %v, 期望 16×16", b)
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/Neurocoda/Antimg/codec"
+	"github.com/disintegration/imaging"
+)
+
+// PixelLimit 输入图片的像素数限制，在完整解码之前根据图片头部声明的尺寸检查，
+// 防止尺寸极大但文件很小的图片（解压炸弹）耗尽内存
+type PixelLimit struct {
+	MaxPixels       int  // 允许处理的最大像素数，0 表示不限制
+	Downscale       bool // 超出 MaxPixels 时缩小到限制以内，而不是拒绝
+	MaxDecodePixels int  // 缩小模式下允许解码的最大像素数，超出时仍然拒绝
+}
+
+// ImageTooLargeError 图片像素数超过限制
+type ImageTooLargeError struct {
+	Width, Height int
+	MaxPixels     int
+}
+
+func (e *ImageTooLargeError) Error() string {
+	return fmt.Sprintf("图片尺寸 %dx%d 超过限制，最多支持 %.1f 百万像素", e.Width, e.Height, float64(e.MaxPixels)/1e6)
+}
+
+// check 检查图片头部声明的尺寸，返回是否需要在解码后缩小
+func (l PixelLimit) check(cfg image.Config) (bool, error) {
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	if l.MaxPixels <= 0 || pixels <= int64(l.MaxPixels) {
+		return false, nil
+	}
+	if !l.Downscale {
+		return false, &ImageTooLargeError{Width: cfg.Width, Height: cfg.Height, MaxPixels: l.MaxPixels}
+	}
+	if l.MaxDecodePixels > 0 && pixels > int64(l.MaxDecodePixels) {
+		return false, &ImageTooLargeError{Width: cfg.Width, Height: cfg.Height, MaxPixels: l.MaxDecodePixels}
+	}
+	return true, nil
+}
+
+// fit 等比缩小图片，使像素数不超过 MaxPixels
+func (l PixelLimit) fit(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	scale := math.Sqrt(float64(l.MaxPixels) / (float64(w) * float64(h)))
+	if scale >= 1 {
+		return img
+	}
+	return imaging.Resize(img, max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale)), imaging.Lanczos)
+}
+
+// CheckSize 只读取图片头部，检查尺寸是否在限制以内（缩小模式下可缩小的图片视为通过）
+func (s *ImageService) CheckSize(data []byte) error {
+	cfg, _, err := codec.DecodeConfig(data)
+	if err != nil {
+		return err
+	}
+	_, err = s.limit.check(cfg)
+	return err
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AttackStage 攻击阶段接口，每个阶段对图片执行一类独立的攻击
+type AttackStage interface {
+	// Name 阶段名称，用于在处理流程中引用
+	Name() string
+	// Apply 以给定强度和参数执行攻击
+	Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error)
+}
+
+// ParamValidator 可选接口，阶段可在执行前检查参数是否合法
+type ParamValidator interface {
+	ValidateParams(params StageParams) error
+}
+
+// StageEnv 阶段执行时的运行环境，只属于单次处理
+type StageEnv struct {
+	Ctx      context.Context
+	Rng      *rand.Rand                 // 当前请求独占的随机源，不可在多个goroutine间共享
+	Progress func(completed, total int) // 每完成一个阶段回调一次，可为空
+
+	alpha *image.NRGBA // 分离出的透明度平面，几何变换需通过 Rotate/Resize/CropCenter 同步处理
+	fill  FillMode     // 未指定 fill 参数时旋转的默认填充方式，为空时透明填充
+}
+
+// Err 返回上下文的结束原因，阶段应在每轮耗时操作之间检查
+func (e *StageEnv) Err() error {
+	if e.Ctx == nil {
+		return nil
+	}
+	return e.Ctx.Err()
+}
+
+// StageParams 阶段参数，数值参数统一按 float64 读取
+type StageParams map[string]interface{}
+
+// Float 读取数值参数，缺失或无法解析时返回默认值
+func (p StageParams) Float(key string, def float64) float64 {
+	switch v := p[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// Int 读取整数参数
+func (p StageParams) Int(key string, def int) int {
+	if _, ok := p[key]; !ok {
+		return def
+	}
+	return int(p.Float(key, float64(def)))
+}
+
+// String 读取字符串参数
+func (p StageParams) String(key, def string) string {
+	if v, ok := p[key].(string); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// StageConfig 处理流程中的单个阶段配置
+type StageConfig struct {
+	Name   string      `json:"name"`
+	Level  *float64    `json:"level,omitempty"` // 覆盖全局攻击强度
+	Params StageParams `json:"params,omitempty"`
+}
+
+// Pipeline 按顺序执行的阶段列表
+type Pipeline []StageConfig
+
+// 阶段注册表
+var (
+	stages     = make(map[string]AttackStage)
+	stageMutex sync.RWMutex
+)
+
+// RegisterStage 注册攻击阶段，同名阶段会被覆盖
+func RegisterStage(stage AttackStage) {
+	stageMutex.Lock()
+	defer stageMutex.Unlock()
+
+	stages[stage.Name()] = stage
+}
+
+// GetStage 按名称获取攻击阶段
+func GetStage(name string) (AttackStage, bool) {
+	stageMutex.RLock()
+	defer stageMutex.RUnlock()
+
+	stage, exists := stages[name]
+	return stage, exists
+}
+
+// StageNames 返回已注册的阶段名称（按字母排序）
+func StageNames() []string {
+	stageMutex.RLock()
+	defer stageMutex.RUnlock()
+
+	names := make([]string, 0, len(stages))
+	for name := range stages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultPipeline 默认处理流程，与原有的多轮攻击顺序一致
+func DefaultPipeline() Pipeline {
+	return Pipeline{
+		{Name: "geometric"},
+		{Name: "noise"},
+		{Name: "frequency"},
+		{Name: "compression"},
+		{Name: "color"},
+		{Name: "mixed"},
+	}
+}
+
+// ParsePipeline 解析处理流程描述
+// 支持逗号分隔的阶段名称（如 "noise,compression"），
+// 或 JSON 数组（如 [{"name":"geometric","params":{"rotate":0}}]）
+func ParsePipeline(spec string) (Pipeline, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("处理流程不能为空")
+	}
+
+	var pipeline Pipeline
+	if strings.HasPrefix(spec, "[") {
+		if err := json.Unmarshal([]byte(spec), &pipeline); err != nil {
+			return nil, errors.New("处理流程JSON格式错误")
+		}
+	} else {
+		for _, name := range strings.Split(spec, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			pipeline = append(pipeline, StageConfig{Name: name})
+		}
+	}
+
+	if err := pipeline.Validate(); err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
+
+// Validate 检查阶段是否已注册以及强度是否合法
+func (p Pipeline) Validate() error {
+	if len(p) == 0 {
+		return errors.New("处理流程不能为空")
+	}
+	for _, cfg := range p {
+		stage, exists := GetStage(cfg.Name)
+		if !exists {
+			return fmt.Errorf("未知的攻击阶段: %s", cfg.Name)
+		}
+		if v, ok := stage.(ParamValidator); ok {
+			if err := v.ValidateParams(cfg.Params); err != nil {
+				return fmt.Errorf("阶段 %s 参数无效: %w", cfg.Name, err)
+			}
+		}
+		if cfg.Level != nil && (*cfg.Level < 0 || *cfg.Level > 1) {
+			return fmt.Errorf("阶段 %s 的攻击强度必须在0.0-1.0之间", cfg.Name)
+		}
+	}
+	return nil
+}
+
+// Run 依次执行处理流程中的各个阶段
+func (p Pipeline) Run(env *StageEnv, img image.Image, attackLevel float64) (image.Image, error) {
+	result := img
+	for i, cfg := range p {
+		if err := env.Err(); err != nil {
+			return nil, err
+		}
+
+		stage, exists := GetStage(cfg.Name)
+		if !exists {
+			return nil, fmt.Errorf("未知的攻击阶段: %s", cfg.Name)
+		}
+
+		level := attackLevel
+		if cfg.Level != nil {
+			level = *cfg.Level
+		}
+
+		processed, err := stage.Apply(env, result, level, cfg.Params)
+		if err != nil {
+			return nil, fmt.Errorf("阶段 %s 执行失败: %w", cfg.Name, err)
+		}
+		result = processed
+
+		if env.Progress != nil {
+			env.Progress(i+1, len(p))
+		}
+	}
+	return result, nil
+}
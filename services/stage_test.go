@@ -0,0 +1,32 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// applyStage 以固定种子执行单个阶段
+func applyStage(t *testing.T, name string, img image.Image, level float64, params StageParams, seed int64) image.Image {
+	t.Helper()
+	stage, ok := GetStage(name)
+	if !ok {
+		t.Fatalf("未注册的阶段 %s", name)
+	}
+	out, err := stage.Apply(&StageEnv{Rng: rand.New(rand.NewSource(seed))}, img, level, params)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return out
+}
+
+// samePixels 判断两张图片尺寸和像素是否完全相同
+func samePixels(a, b image.Image) bool {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return false
+	}
+	return bytes.Equal(imaging.Clone(a).Pix, imaging.Clone(b).Pix)
+}
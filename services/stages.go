@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+
+	"github.com/disintegration/imaging"
+)
+
+func init() {
+	RegisterStage(geometricStage{})
+	RegisterStage(noiseStage{})
+	RegisterStage(frequencyStage{})
+	RegisterStage(compressionStage{})
+	RegisterStage(colorStage{})
+	RegisterStage(mixedStage{})
+}
+
+// geometricStage 强力几何攻击
+// 参数: rotate 旋转幅度倍数（0 表示不旋转），scale 缩放幅度倍数（0 表示不缩放），
+// fill 旋转填充方式 transparent、edge、mirror、crop，默认见 defaultFill
+type geometricStage struct{}
+
+func (geometricStage) Name() string { return "geometric" }
+
+func (geometricStage) ValidateParams(params StageParams) error { return validateFillParam(params) }
+
+func (geometricStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	bounds := img.Bounds()
+	result := img
+
+	rotate := params.Float("rotate", 1)
+	scale := params.Float("scale", 1)
+	fill, err := env.fillMode(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// 强力旋转攻击
+	if level > 0.2 && rotate > 0 {
+		angle := (env.Rng.Float64() - 0.5) * level * 15 * rotate // 大幅增加旋转角度
+		result = env.Rotate(result, angle, fill)
+	}
+
+	// 强力缩放攻击
+	if level > 0.3 && scale > 0 {
+		scaleFactor := 1.0 + (env.Rng.Float64()-0.5)*level*0.2*scale // 大幅增加缩放范围
+		newWidth := max(1, int(float64(bounds.Dx())*scaleFactor))
+		newHeight := max(1, int(float64(bounds.Dy())*scaleFactor))
+		result = env.Resize(result, newWidth, newHeight)
+		// 裁剪回原始大小
+		result = env.CropCenter(result, bounds.Dx(), bounds.Dy())
+	}
+
+	// 多轮几何变换
+	rounds := params.Int("rounds", int(level*3)+1)
+	for i := 0; i < rounds; i++ {
+		if err := env.Err(); err != nil {
+			return nil, err
+		}
+
+		// 随机旋转
+		if rotate > 0 {
+			angle := (env.Rng.Float64() - 0.5) * level * 8 * rotate
+			result = env.Rotate(result, angle, fill)
+		}
+
+		// 随机缩放
+		if scale > 0 {
+			factor := 1.0 + (env.Rng.Float64()-0.5)*level*0.1*scale
+			newW := max(1, int(float64(bounds.Dx())*factor))
+			newH := max(1, int(float64(bounds.Dy())*factor))
+			result = env.Resize(result, newW, newH)
+		}
+		result = env.CropCenter(result, bounds.Dx(), bounds.Dy())
+	}
+
+	// 最终强力变换
+	if level > 0.8 && rotate > 0 {
+		finalAngle := (env.Rng.Float64() - 0.5) * level * 20 * rotate
+		result = env.Rotate(result, finalAngle, fill)
+	}
+
+	return result, nil
+}
+
+// noiseStage 强力噪声攻击
+// 参数: brightness 亮度变化倍数，contrast 对比度变化倍数
+type noiseStage struct{}
+
+func (noiseStage) Name() string { return "noise" }
+
+func (noiseStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	result := imaging.Clone(img)
+
+	brightness := params.Float("brightness", 1)
+	contrast := params.Float("contrast", 1)
+
+	// 强力亮度攻击
+	brightnessChange := (env.Rng.Float64() - 0.5) * level * 60 * brightness // 最大±30亮度变化
+	result = imaging.AdjustBrightness(result, brightnessChange)
+
+	// 强力对比度攻击
+	contrastChange := (env.Rng.Float64() - 0.5) * level * 80 * contrast // 最大±40对比度变化
+	result = imaging.AdjustContrast(result, contrastChange)
+
+	// 多次随机调整
+	rounds := params.Int("rounds", int(level*3)+1)
+	for i := 0; i < rounds; i++ {
+		if err := env.Err(); err != nil {
+			return nil, err
+		}
+
+		b := (env.Rng.Float64() - 0.5) * level * 20 * brightness
+		c := (env.Rng.Float64() - 0.5) * level * 30 * contrast
+		result = imaging.AdjustBrightness(result, b)
+		result = imaging.AdjustContrast(result, c)
+	}
+
+	return result, nil
+}
+
+// frequencyStage 强力频域攻击
+// 参数: blur 模糊半径倍数，sharpen 锐化强度倍数
+type frequencyStage struct{}
+
+func (frequencyStage) Name() string { return "frequency" }
+
+func (frequencyStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	result := img
+
+	blur := params.Float("blur", 1)
+	sharpen := params.Float("sharpen", 1)
+
+	// 强力模糊攻击
+	blurRadius := level * 3.0 * blur // 大幅增加模糊半径
+	if blurRadius > 0.5 {
+		result = imaging.Blur(result, blurRadius)
+	}
+
+	// 强力锐化攻击
+	if level > 0.3 && sharpen > 0 {
+		sharpenAmount := level * 5.0 * sharpen // 大幅增加锐化强度
+		result = imaging.Sharpen(result, sharpenAmount)
+	}
+
+	// 交替模糊和锐化
+	rounds := params.Int("rounds", int(level*2)+1)
+	for i := 0; i < rounds; i++ {
+		if err := env.Err(); err != nil {
+			return nil, err
+		}
+
+		if i%2 == 0 {
+			if blur > 0 {
+				result = imaging.Blur(result, level*2.0*blur)
+			}
+		} else if sharpen > 0 {
+			result = imaging.Sharpen(result, level*3.0*sharpen)
+		}
+	}
+
+	// 最终强力模糊
+	if level > 0.7 && blur > 0 {
+		result = imaging.Blur(result, level*4.0*blur)
+	}
+
+	return result, nil
+}
+
+// compressionStage 强力压缩攻击
+// 参数: rounds 压缩轮数，minQuality 最低JPEG质量
+type compressionStage struct{}
+
+func (compressionStage) Name() string { return "compression" }
+
+func (compressionStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	minQuality := params.Int("minQuality", 20)
+
+	// 根据攻击等级调整JPEG质量 - 更激进
+	quality := 100 - int(level*60) // 质量从100降到40
+	if quality < 30 {
+		quality = 30
+	}
+
+	// 多轮压缩攻击
+	result := img
+	compressionRounds := params.Int("rounds", int(level*5)+1) // 最多6轮压缩
+
+	for i := 0; i < compressionRounds; i++ {
+		if err := env.Err(); err != nil {
+			return nil, err
+		}
+
+		// 每轮都降低质量
+		currentQuality := quality - i*5
+		if currentQuality < minQuality {
+			currentQuality = minQuality
+		}
+
+		var buf bytes.Buffer
+		jpeg.Encode(&buf, result, &jpeg.Options{Quality: currentQuality})
+
+		// 解码回图片
+		decodedImg, err := jpeg.Decode(&buf)
+		if err != nil {
+			return img, nil // 如果失败，返回原图
+		}
+		result = decodedImg
+	}
+
+	return result, nil
+}
+
+// colorStage 强力颜色攻击
+// 参数: brightness 亮度变化倍数，contrast 对比度变化倍数
+type colorStage struct{}
+
+func (colorStage) Name() string { return "color" }
+
+func (colorStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	result := img
+
+	brightness := params.Float("brightness", 1)
+	contrast := params.Float("contrast", 1)
+
+	// 强力亮度和对比度攻击
+	rounds := params.Int("rounds", int(level*4)+1)
+	for i := 0; i < rounds; i++ {
+		if err := env.Err(); err != nil {
+			return nil, err
+		}
+
+		brightnessChange := (env.Rng.Float64() - 0.5) * level * 50 * brightness // 大幅增加亮度变化
+		contrastChange := (env.Rng.Float64() - 0.5) * level * 60 * contrast     // 大幅增加对比度变化
+		result = imaging.AdjustBrightness(result, brightnessChange)
+		result = imaging.AdjustContrast(result, contrastChange)
+	}
+
+	return result, nil
+}
+
+// mixedStage 最终混合攻击，仅在攻击强度高于阈值时执行
+// 参数: threshold 触发阈值（默认0.7），rounds 轮数，rotate 旋转幅度倍数，fill 旋转填充方式（同 geometric）
+type mixedStage struct{}
+
+func (mixedStage) Name() string { return "mixed" }
+
+func (mixedStage) ValidateParams(params StageParams) error { return validateFillParam(params) }
+
+func (mixedStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	if level <= params.Float("threshold", 0.7) {
+		return img, nil
+	}
+
+	result := img
+	rotate := params.Float("rotate", 1)
+	fill, err := env.fillMode(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// 最终破坏性攻击组合
+	rounds := params.Int("rounds", 3)
+	for i := 0; i < rounds; i++ {
+		if err := env.Err(); err != nil {
+			return nil, err
+		}
+
+		// 强力模糊
+		result = imaging.Blur(result, level*5.0)
+
+		// 强力锐化
+		result = imaging.Sharpen(result, level*6.0)
+
+		// 强力亮度对比度调整
+		brightness := (env.Rng.Float64() - 0.5) * level * 40
+		contrast := (env.Rng.Float64() - 0.5) * level * 50
+		result = imaging.AdjustBrightness(result, brightness)
+		result = imaging.AdjustContrast(result, contrast)
+
+		// 旋转攻击
+		if rotate > 0 {
+			angle := (env.Rng.Float64() - 0.5) * level * 10 * rotate
+			result = env.Rotate(result, angle, fill)
+		}
+
+		// 压缩攻击
+		quality := 50 - int(level*30)
+		if quality < 15 {
+			quality = 15
+		}
+		var buf bytes.Buffer
+		jpeg.Encode(&buf, result, &jpeg.Options{Quality: quality})
+		decodedImg, err := jpeg.Decode(&buf)
+		if err == nil {
+			result = decodedImg
+		}
+	}
+
+	return result, nil
+}
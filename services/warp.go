@@ -0,0 +1,284 @@
+package services
+
+import (
+	"errors"
+	"image"
+	"math"
+	"math/rand"
+)
+
+func init() {
+	RegisterStage(meshStage{})
+	RegisterStage(perspectiveStage{})
+}
+
+// parseBorderFill 解析保持原尺寸的重采样阶段的 fill 参数，默认 mirror；
+// 只支持 edge、mirror，allowCrop 时还支持 crop
+func parseBorderFill(params StageParams, allowCrop bool) (FillMode, error) {
+	fill, err := ParseFillMode(params.String("fill", string(FillMirror)))
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case fill == FillEdge || fill == FillMirror:
+		return fill, nil
+	case fill == FillCrop && allowCrop:
+		return fill, nil
+	case allowCrop:
+		return "", errors.New("fill 参数仅支持 edge、mirror 或 crop")
+	}
+	return "", errors.New("fill 参数仅支持 edge 或 mirror")
+}
+
+// meshStage StirMark 式局部非线性几何攻击：在稀疏网格的控制点上生成随机位移，
+// 插值为平滑的位移场后做亚像素重采样，打破依赖同步的水印而不产生明显的整体形变
+// 参数: amplitude 强度为1时控制点的最大位移（像素，默认3），
+// grid 长边方向的网格数（默认随强度在4-12之间），fill 越界填充方式 mirror（默认）或 edge
+type meshStage struct{}
+
+func (meshStage) Name() string { return "mesh" }
+
+func (meshStage) ValidateParams(params StageParams) error {
+	_, err := parseBorderFill(params, false)
+	return err
+}
+
+func (meshStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	amplitude := level * params.Float("amplitude", 3)
+	if amplitude <= 0 {
+		return img, nil
+	}
+	fill, err := parseBorderFill(params, false)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w < 2 || h < 2 {
+		return img, nil
+	}
+	cells := max(1, params.Int("grid", 4+int(level*8)))
+	cellSize := float64(max(w, h)) / float64(cells)
+
+	dx := displacementField(env.Rng, w, h, cellSize, amplitude)
+	dy := displacementField(env.Rng, w, h, cellSize, amplitude)
+	if err := env.Err(); err != nil {
+		return nil, err
+	}
+
+	return env.Remap(img, w, h, func(x, y int) (float64, float64) {
+		i := y*w + x
+		return float64(x) + float64(dx[i]), float64(y) + float64(dy[i])
+	}, fill), nil
+}
+
+// displacementField 在间距为 cellSize 的网格控制点上取 [-amplitude, amplitude] 的随机位移，
+// 用 Catmull-Rom 样条插值到每个像素，得到 w×h 的连续平滑位移场
+func displacementField(rng *rand.Rand, w, h int, cellSize, amplitude float64) []float32 {
+	gw := int(math.Ceil(float64(w-1)/cellSize)) + 1
+	gh := int(math.Ceil(float64(h-1)/cellSize)) + 1
+	grid := make([]float64, gw*gh)
+	for i := range grid {
+		grid[i] = (rng.Float64()*2 - 1) * amplitude
+	}
+
+	// 先沿 x 方向插值每一行控制点，再沿 y 方向插值
+	rows := make([]float64, gh*w)
+	for gy := 0; gy < gh; gy++ {
+		line := grid[gy*gw : (gy+1)*gw]
+		for x := 0; x < w; x++ {
+			rows[gy*w+x] = catmullRom(line, float64(x)/cellSize)
+		}
+	}
+
+	field := make([]float32, w*h)
+	column := make([]float64, gh)
+	for x := 0; x < w; x++ {
+		for gy := range column {
+			column[gy] = rows[gy*w+x]
+		}
+		for y := 0; y < h; y++ {
+			field[y*w+x] = float32(catmullRom(column, float64(y)/cellSize))
+		}
+	}
+	return field
+}
+
+// catmullRom 在等距控制点 p 上按位置 t（以控制点间距为单位）做 Catmull-Rom 插值，两端外的点取端点值
+func catmullRom(p []float64, t float64) float64 {
+	n := len(p)
+	i := min(int(t), n-1)
+	f := t - float64(i)
+	at := func(k int) float64 { return p[max(0, min(n-1, k))] }
+	p0, p1, p2, p3 := at(i-1), at(i), at(i+1), at(i+2)
+	return p1 + 0.5*f*(p2-p0+f*(2*p0-5*p1+4*p2-p3+f*(3*(p1-p2)+p3-p0)))
+}
+
+// perspectiveStage 轻微的随机透视变换：四角抖动叠加错切和各向异性缩放，
+// 与 geometric 阶段的整体旋转缩放互补，边界按 fill 参数处理，不会留下透明或黑色的楔形
+// 参数: corner 强度为1时四角的最大抖动（短边的比例，默认0.03），shear 最大错切（默认0.05），
+// scale 最大各向异性缩放幅度（默认0.05），fill 边界处理方式 mirror（默认，镜像）、edge（延伸边缘）、
+// crop（裁剪到有效区域的内接矩形后缩放回原尺寸）
+type perspectiveStage struct{}
+
+func (perspectiveStage) Name() string { return "perspective" }
+
+func (perspectiveStage) ValidateParams(params StageParams) error {
+	_, err := parseBorderFill(params, true)
+	return err
+}
+
+func (perspectiveStage) Apply(env *StageEnv, img image.Image, level float64, params StageParams) (image.Image, error) {
+	if level <= 0 {
+		return img, nil
+	}
+	fill, err := parseBorderFill(params, true)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w < 2 || h < 2 {
+		return img, nil
+	}
+	m, ok := perspectiveMatrix(env.Rng, w, h, level, params)
+	if !ok {
+		return img, nil
+	}
+	mapping := func(x, y int) (float64, float64) { return m.apply(float64(x), float64(y)) }
+
+	if fill == FillCrop {
+		// 以中心为基准缩小采样矩形，直到四角都落在源图内，裁剪和缩放合并为一次重采样；
+		// 中心本身已越界（参数过大）时无法裁剪，改为镜像填充
+		fill = FillMirror
+		if s, ok := cropScale(m, w, h); ok {
+			cx, cy := float64(w-1)/2, float64(h-1)/2
+			mapping = func(x, y int) (float64, float64) {
+				return m.apply(cx+(float64(x)-cx)*s, cy+(float64(y)-cy)*s)
+			}
+			fill = FillEdge
+		}
+	}
+
+	return env.Remap(img, w, h, mapping, fill), nil
+}
+
+// perspectiveMatrix 生成随机透视变换，返回输出图片坐标到源图坐标的映射
+func perspectiveMatrix(rng *rand.Rand, w, h int, level float64, params StageParams) (projective, bool) {
+	fw, fh := float64(w-1), float64(h-1)
+	cx, cy := fw/2, fh/2
+
+	random := func(amount float64) float64 { return (rng.Float64()*2 - 1) * level * amount }
+	shear := random(params.Float("shear", 0.05))
+	sx := 1 + random(params.Float("scale", 0.05))
+	sy := 1 + random(params.Float("scale", 0.05))
+	jitter := params.Float("corner", 0.03) * math.Min(fw, fh)
+
+	// 输出图片四角在源图中的采样位置
+	var sources [4][2]float64
+	for i, c := range rectCorners(fw, fh) {
+		dx, dy := c[0]-cx, c[1]-cy
+		sources[i] = [2]float64{
+			cx + sx*(dx+shear*dy) + random(jitter),
+			cy + sy*dy + random(jitter),
+		}
+	}
+	return homography(rectCorners(fw, fh), sources)
+}
+
+// rectCorners 返回 [0, fw]×[0, fh] 矩形按顺时针排列的四角
+func rectCorners(fw, fh float64) [4][2]float64 {
+	return [4][2]float64{{0, 0}, {fw, 0}, {fw, fh}, {0, fh}}
+}
+
+// cropScale 求最大的缩放比例 s ∈ (0, 1]，使 w×h 的输出矩形以中心为基准缩放 s 倍后，
+// 经 m 映射后整个矩形都落在源图内。齐次分母在四角均为正时矩形不跨越无穷远线，
+// 映射结果是以四角映射点为顶点的凸四边形，只需检查四角。
+// 中心本身映射到源图外时返回 false
+func cropScale(m projective, w, h int) (float64, bool) {
+	fw, fh := float64(w-1), float64(h-1)
+	cx, cy := fw/2, fh/2
+	inside := func(s float64) bool {
+		for _, c := range rectCorners(fw, fh) {
+			x, y := cx+(c[0]-cx)*s, cy+(c[1]-cy)*s
+			if m[6]*x+m[7]*y+m[8] <= 0 {
+				return false
+			}
+			u, v := m.apply(x, y)
+			if !(u >= 0 && u <= fw && v >= 0 && v <= fh) {
+				return false
+			}
+		}
+		return true
+	}
+	if inside(1) {
+		return 1, true
+	}
+	if !inside(0) {
+		return 0, false
+	}
+
+	// 二分查找，lo 始终满足条件
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 40; i++ {
+		if mid := (lo + hi) / 2; inside(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		return 0, false
+	}
+	return lo, true
+}
+
+// projective 3×3 射影变换矩阵（按行存储，m[8] 固定为1）
+type projective [9]float64
+
+// apply 变换点 (x, y)
+func (m projective) apply(x, y float64) (float64, float64) {
+	d := m[6]*x + m[7]*y + m[8]
+	return (m[0]*x + m[1]*y + m[2]) / d, (m[3]*x + m[4]*y + m[5]) / d
+}
+
+// homography 求将 from 的四个点分别映射到 to 的射影变换，四点共线等退化情况返回 false
+func homography(from, to [4][2]float64) (projective, bool) {
+	// 8 元线性方程组的增广矩阵，高斯消元（列主元）求解
+	var a [8][9]float64
+	for i := 0; i < 4; i++ {
+		x, y, u, v := from[i][0], from[i][1], to[i][0], to[i][1]
+		a[2*i] = [9]float64{x, y, 1, 0, 0, 0, -u * x, -u * y, u}
+		a[2*i+1] = [9]float64{0, 0, 0, x, y, 1, -v * x, -v * y, v}
+	}
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for r := col + 1; r < 8; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return projective{}, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for r := 0; r < 8; r++ {
+			if r == col {
+				continue
+			}
+			f := a[r][col] / a[col][col]
+			for c := col; c < 9; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+		}
+	}
+
+	var m projective
+	for i := 0; i < 8; i++ {
+		m[i] = a[i][8] / a[i][i]
+	}
+	m[8] = 1
+	return m, true
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestHomographyCorners(t *testing.T) {
+	from := rectCorners(99, 59)
+	for _, to := range [][4][2]float64{
+		from,
+		{{3, -2}, {101, 4}, {95, 63}, {-4, 57}},
+		{{10, 10}, {40, 12}, {38, 30}, {12, 28}},
+	} {
+		m, ok := homography(from, to)
+		if !ok {
+			t.Fatalf("%v: 求解失败", to)
+		}
+		for i, p := range from {
+			u, v := m.apply(p[0], p[1])
+			if math.Abs(u-to[i][0]) > 1e-9 || math.Abs(v-to[i][1]) > 1e-9 {
+				t.Errorf("%v: 角 %v 映射到 (%g, %g), 期望 %v", to, p, u, v, to[i])
+			}
+		}
+	}
+
+	// 恒等映射把中心映射到自身
+	m, _ := homography(from, from)
+	if u, v := m.apply(49.5, 29.5); math.Abs(u-49.5) > 1e-9 || math.Abs(v-29.5) > 1e-9 {
+		t.Errorf("恒等映射: 中心映射到 (%g, %g)", u, v)
+	}
+}
+
+func TestHomographyDegenerate(t *testing.T) {
+	target := rectCorners(10, 10)
+	for _, from := range [][4][2]float64{
+		{{0, 0}, {1, 1}, {2, 2}, {3, 3}},    // 四点共线
+		{{0, 0}, {0, 0}, {10, 10}, {0, 10}}, // 重复点
+		{{5, 5}, {5, 5}, {5, 5}, {5, 5}},    // 全部重合
+	} {
+		if _, ok := homography(from, target); ok {
+			t.Errorf("%v: 退化输入应返回 false", from)
+		}
+	}
+}
+
+// crop 模式下所有输出像素都应从源图范围内采样，不会出现边缘延伸的像素
+func TestPerspectiveCropInBounds(t *testing.T) {
+	const w, h = 64, 48
+	fw, fh := float64(w-1), float64(h-1)
+	for _, params := range []StageParams{
+		nil,
+		{"corner": 0.2, "shear": 0.3, "scale": 0.3},
+		{"corner": 0.45, "shear": 0.5, "scale": 0.6},
+	} {
+		for seed := int64(1); seed <= 200; seed++ {
+			m, ok := perspectiveMatrix(rand.New(rand.NewSource(seed)), w, h, 1, params)
+			if !ok {
+				continue
+			}
+			s, ok := cropScale(m, w, h)
+			if !ok {
+				continue
+			}
+			cx, cy := fw/2, fh/2
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					u, v := m.apply(cx+(float64(x)-cx)*s, cy+(float64(y)-cy)*s)
+					if u < -1e-9 || u > fw+1e-9 || v < -1e-9 || v > fh+1e-9 {
+						t.Fatalf("%v 种子 %d: (%d, %d) 采样位置 (%g, %g) 越界，s = %g", params, seed, x, y, u, v, s)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPerspectiveStage(t *testing.T) {
+	img := photoLike(64, 48)
+	for _, fill := range []string{"mirror", "edge", "crop"} {
+		for _, params := range []StageParams{
+			{"fill": fill},
+			{"fill": fill, "corner": 0.45, "shear": 0.5, "scale": 0.6},
+		} {
+			if out := applyStage(t, "perspective", img, 0, params, 1); !samePixels(out, img) {
+				t.Errorf("%v: 强度为0时图片应保持不变", params)
+			}
+			a := applyStage(t, "perspective", img, 1, params, 1)
+			if a.Bounds().Size() != img.Bounds().Size() {
+				t.Errorf("%v: 尺寸 %v", params, a.Bounds().Size())
+			}
+			if b := applyStage(t, "perspective", img, 1, params, 1); !samePixels(a, b) {
+				t.Errorf("%v: 相同种子的结果不一致", params)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package transform
+
+import "math"
+
+// BlockSize DCT 块的边长
+const BlockSize = 8
+
+// dctBasis[u][x] 正交归一化的一维 DCT-II 基函数
+var dctBasis = func() [BlockSize][BlockSize]float64 {
+	var basis [BlockSize][BlockSize]float64
+	for u := 0; u < BlockSize; u++ {
+		scale := math.Sqrt(2.0 / BlockSize)
+		if u == 0 {
+			scale = math.Sqrt(1.0 / BlockSize)
+		}
+		for x := 0; x < BlockSize; x++ {
+			basis[u][x] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*BlockSize))
+		}
+	}
+	return basis
+}()
+
+// Block 8×8 块，按行存储，DCT 系数中 [v*8+u] 为竖直频率 v、水平频率 u 的系数
+type Block [BlockSize * BlockSize]float64
+
+// DCT 对块做正交归一化的二维 DCT-II（原地）
+func (b *Block) DCT() {
+	b.transform(false)
+}
+
+// IDCT 对块做二维逆 DCT（原地）
+func (b *Block) IDCT() {
+	b.transform(true)
+}
+
+// transform 先按行、再按列做可分离的一维变换
+func (b *Block) transform(inverse bool) {
+	var tmp Block
+	for y := 0; y < BlockSize; y++ {
+		for u := 0; u < BlockSize; u++ {
+			var sum float64
+			for x := 0; x < BlockSize; x++ {
+				if inverse {
+					sum += dctBasis[x][u] * b[y*BlockSize+x]
+				} else {
+					sum += dctBasis[u][x] * b[y*BlockSize+x]
+				}
+			}
+			tmp[y*BlockSize+u] = sum
+		}
+	}
+	for x := 0; x < BlockSize; x++ {
+		for v := 0; v < BlockSize; v++ {
+			var sum float64
+			for y := 0; y < BlockSize; y++ {
+				if inverse {
+					sum += dctBasis[y][v] * tmp[y*BlockSize+x]
+				} else {
+					sum += dctBasis[v][y] * tmp[y*BlockSize+x]
+				}
+			}
+			b[v*BlockSize+x] = sum
+		}
+	}
+}
+
+// Blocks 返回平面中完整 8×8 块的列数和行数，右侧和底部不足一块的像素不参与变换
+func (p *Plane) Blocks() (int, int) {
+	return p.Width / BlockSize, p.Height / BlockSize
+}
+
+// ReadBlock 读取第 (bx, by) 个块
+func (p *Plane) ReadBlock(bx, by int, b *Block) {
+	for y := 0; y < BlockSize; y++ {
+		copy(b[y*BlockSize:(y+1)*BlockSize], p.Pix[(by*BlockSize+y)*p.Width+bx*BlockSize:])
+	}
+}
+
+// WriteBlock 写回第 (bx, by) 个块
+func (p *Plane) WriteBlock(bx, by int, b *Block) {
+	for y := 0; y < BlockSize; y++ {
+		copy(p.Pix[(by*BlockSize+y)*p.Width+bx*BlockSize:], b[y*BlockSize:(y+1)*BlockSize])
+	}
+}
@@ -0,0 +1,56 @@
+package transform
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBlockDCTInverse(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 100; n++ {
+		var b Block
+		for i := range b {
+			b[i] = rng.Float64()*255 - 128
+		}
+		orig := b
+		b.DCT()
+		b.IDCT()
+		for i := range b {
+			if d := math.Abs(b[i] - orig[i]); d > 1e-9 {
+				t.Fatalf("第%d个块的 [%d] 误差 %g", n, i, d)
+			}
+		}
+	}
+}
+
+// 正交归一化 DCT：常数块只有直流系数（8倍常数），且变换前后能量不变
+func TestBlockDCTCoefficients(t *testing.T) {
+	var b Block
+	for i := range b {
+		b[i] = 10
+	}
+	b.DCT()
+	if math.Abs(b[0]-80) > 1e-9 {
+		t.Errorf("直流系数 %g, 期望 80", b[0])
+	}
+	for i := 1; i < len(b); i++ {
+		if math.Abs(b[i]) > 1e-9 {
+			t.Fatalf("常数块的交流系数 [%d] = %g", i, b[i])
+		}
+	}
+
+	rng := rand.New(rand.NewSource(2))
+	var energy, coeffEnergy float64
+	for i := range b {
+		b[i] = rng.Float64() * 255
+		energy += b[i] * b[i]
+	}
+	b.DCT()
+	for _, c := range b {
+		coeffEnergy += c * c
+	}
+	if math.Abs(energy-coeffEnergy) > 1e-6*energy {
+		t.Errorf("能量 %g 变换后为 %g", energy, coeffEnergy)
+	}
+}
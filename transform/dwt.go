@@ -0,0 +1,197 @@
+package transform
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// Wavelet 正交小波的分解低通滤波器
+type Wavelet struct {
+	Name string
+	low  []float64
+}
+
+var (
+	// Haar 最简单的正交小波，2个系数
+	Haar = Wavelet{Name: "haar", low: []float64{1 / math.Sqrt2, 1 / math.Sqrt2}}
+	// Daubechies4 4个系数的 Daubechies 小波（db2）
+	Daubechies4 = Wavelet{Name: "db4", low: func() []float64 {
+		s3 := math.Sqrt(3)
+		d := 4 * math.Sqrt2
+		return []float64{(1 + s3) / d, (3 + s3) / d, (3 - s3) / d, (1 - s3) / d}
+	}()}
+)
+
+// ParseWavelet 按名称查找小波: haar 或 db4
+func ParseWavelet(name string) (Wavelet, error) {
+	switch strings.ToLower(name) {
+	case "", Haar.Name:
+		return Haar, nil
+	case Daubechies4.Name, "db2", "daubechies":
+		return Daubechies4, nil
+	}
+	return Wavelet{}, errors.New("未知的小波: " + name + "，仅支持 haar、db4")
+}
+
+// high 由低通滤波器按正交镜像关系生成高通滤波器
+func (w Wavelet) high() []float64 {
+	n := len(w.low)
+	g := make([]float64, n)
+	for i := range g {
+		g[i] = w.low[n-1-i]
+		if i%2 == 1 {
+			g[i] = -g[i]
+		}
+	}
+	return g
+}
+
+// Subbands 一级二维小波分解的四个子带，每个子带尺寸为原平面的一半（向上取整）
+// LL 为近似分量，LH、HL、HH 分别为水平、竖直和对角方向的细节分量
+type Subbands struct {
+	LL, LH, HL, HH *Plane
+	width, height  int // 分解前的平面尺寸，重建时裁剪回该尺寸
+	wavelet        Wavelet
+}
+
+// DWT 对平面做一级二维小波分解，使用周期延拓；尺寸为奇数时先复制最后一行或一列
+func DWT(p *Plane, w Wavelet) *Subbands {
+	src := padEven(p)
+	hw, hh := src.Width/2, src.Height/2
+
+	// 先按行分解为左右两半，再按列分解为上下两半
+	rows := NewPlane(src.Width, src.Height)
+	line := make([]float64, src.Width)
+	lo, hi := make([]float64, hw), make([]float64, hw)
+	for y := 0; y < src.Height; y++ {
+		for x := range line {
+			line[x] = src.Pix[y*src.Width+x]
+		}
+		w.analyze(line, lo, hi)
+		for x := 0; x < hw; x++ {
+			rows.Pix[y*src.Width+x] = lo[x]
+			rows.Pix[y*src.Width+hw+x] = hi[x]
+		}
+	}
+
+	s := &Subbands{
+		LL: NewPlane(hw, hh), LH: NewPlane(hw, hh), HL: NewPlane(hw, hh), HH: NewPlane(hw, hh),
+		width: p.Width, height: p.Height, wavelet: w,
+	}
+	col := make([]float64, src.Height)
+	lo, hi = make([]float64, hh), make([]float64, hh)
+	for x := 0; x < src.Width; x++ {
+		for y := range col {
+			col[y] = rows.Pix[y*src.Width+x]
+		}
+		w.analyze(col, lo, hi)
+		top, bottom := s.LL, s.HL
+		bx := x
+		if x >= hw {
+			top, bottom, bx = s.LH, s.HH, x-hw
+		}
+		for y := 0; y < hh; y++ {
+			top.Pix[y*hw+bx] = lo[y]
+			bottom.Pix[y*hw+bx] = hi[y]
+		}
+	}
+	return s
+}
+
+// Inverse 由四个子带重建平面
+func (s *Subbands) Inverse() *Plane {
+	hw, hh := s.LL.Width, s.LL.Height
+	width, height := 2*hw, 2*hh
+	w := s.wavelet
+
+	rows := NewPlane(width, height)
+	lo, hi := make([]float64, hh), make([]float64, hh)
+	col := make([]float64, height)
+	for x := 0; x < width; x++ {
+		top, bottom := s.LL, s.HL
+		bx := x
+		if x >= hw {
+			top, bottom, bx = s.LH, s.HH, x-hw
+		}
+		for y := 0; y < hh; y++ {
+			lo[y] = top.Pix[y*hw+bx]
+			hi[y] = bottom.Pix[y*hw+bx]
+		}
+		w.synthesize(lo, hi, col)
+		for y := range col {
+			rows.Pix[y*width+x] = col[y]
+		}
+	}
+
+	out := NewPlane(width, height)
+	lo, hi = make([]float64, hw), make([]float64, hw)
+	line := make([]float64, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < hw; x++ {
+			lo[x] = rows.Pix[y*width+x]
+			hi[x] = rows.Pix[y*width+hw+x]
+		}
+		w.synthesize(lo, hi, line)
+		for x := range line {
+			out.Pix[y*width+x] = line[x]
+		}
+	}
+	return crop(out, s.width, s.height)
+}
+
+// analyze 一维分解：a[k] = Σ h[n]·x[2k+n]，d[k] = Σ g[n]·x[2k+n]（周期延拓）
+func (w Wavelet) analyze(x, a, d []float64) {
+	h, g := w.low, w.high()
+	n := len(x)
+	for k := range a {
+		var sa, sd float64
+		for i := range h {
+			v := x[(2*k+i)%n]
+			sa += h[i] * v
+			sd += g[i] * v
+		}
+		a[k], d[k] = sa, sd
+	}
+}
+
+// synthesize 一维重建，正交滤波器组下为 analyze 的转置
+func (w Wavelet) synthesize(a, d, x []float64) {
+	h, g := w.low, w.high()
+	n := len(x)
+	clear(x)
+	for k := range a {
+		for i := range h {
+			j := (2*k + i) % n
+			x[j] += h[i]*a[k] + g[i]*d[k]
+		}
+	}
+}
+
+// padEven 将宽高补齐为偶数，补充的行列复制边缘像素
+func padEven(p *Plane) *Plane {
+	if p.Width%2 == 0 && p.Height%2 == 0 {
+		return p
+	}
+	w, h := p.Width+p.Width%2, p.Height+p.Height%2
+	out := NewPlane(w, h)
+	for y := 0; y < h; y++ {
+		sy := min(y, p.Height-1)
+		for x := 0; x < w; x++ {
+			out.Pix[y*w+x] = p.Pix[sy*p.Width+min(x, p.Width-1)]
+		}
+	}
+	return out
+}
+
+// crop 裁剪平面左上角的 width×height 区域
+func crop(p *Plane, width, height int) *Plane {
+	if p.Width == width && p.Height == height {
+		return p
+	}
+	out := NewPlane(width, height)
+	for y := 0; y < height; y++ {
+		copy(out.Pix[y*width:(y+1)*width], p.Pix[y*p.Width:])
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package transform
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func randomPlane(w, h int, seed int64) *Plane {
+	rng := rand.New(rand.NewSource(seed))
+	p := NewPlane(w, h)
+	for i := range p.Pix {
+		p.Pix[i] = rng.Float64() * 255
+	}
+	return p
+}
+
+func maxAbsDiff(a, b *Plane) float64 {
+	var d float64
+	for i := range a.Pix {
+		d = math.Max(d, math.Abs(a.Pix[i]-b.Pix[i]))
+	}
+	return d
+}
+
+// 正交小波在周期延拓下可以完全重建，奇数尺寸补齐后再裁剪回原尺寸
+func TestDWTPerfectReconstruction(t *testing.T) {
+	for _, w := range []Wavelet{Haar, Daubechies4} {
+		for _, size := range [][2]int{{64, 48}, {37, 29}, {16, 1}, {1, 9}, {33, 64}} {
+			for levels := 1; levels <= 3; levels++ {
+				p := randomPlane(size[0], size[1], int64(levels))
+
+				// 逐级分解 LL，再自底向上重建
+				bands := make([]*Subbands, 0, levels)
+				ll := p
+				for j := 0; j < levels; j++ {
+					s := DWT(ll, w)
+					bands = append(bands, s)
+					ll = s.LL
+				}
+				for j := len(bands) - 1; j >= 0; j-- {
+					rebuilt := bands[j].Inverse()
+					if j > 0 {
+						bands[j-1].LL = rebuilt
+					} else {
+						ll = rebuilt
+					}
+				}
+
+				if ll.Width != p.Width || ll.Height != p.Height {
+					t.Fatalf("%s %v 第%d级: 重建尺寸 %dx%d", w.Name, size, levels, ll.Width, ll.Height)
+				}
+				if d := maxAbsDiff(p, ll); d > 1e-9 {
+					t.Errorf("%s %v 第%d级: 最大误差 %g", w.Name, size, levels, d)
+				}
+			}
+		}
+	}
+}
+
+// 子带尺寸为原尺寸的一半（向上取整），常数平面的能量全部集中在 LL
+func TestDWTSubbands(t *testing.T) {
+	for _, w := range []Wavelet{Haar, Daubechies4} {
+		p := NewPlane(9, 6)
+		for i := range p.Pix {
+			p.Pix[i] = 100
+		}
+		s := DWT(p, w)
+		if s.LL.Width != 5 || s.LL.Height != 3 {
+			t.Errorf("%s: LL 尺寸 %dx%d, 期望 5x3", w.Name, s.LL.Width, s.LL.Height)
+		}
+		for _, band := range []*Plane{s.LH, s.HL, s.HH} {
+			for _, c := range band.Pix {
+				if math.Abs(c) > 1e-9 {
+					t.Fatalf("%s: 常数平面的细节系数 %g", w.Name, c)
+				}
+			}
+		}
+		// 二维正交变换每级将常数放大为2倍
+		for _, c := range s.LL.Pix {
+			if math.Abs(c-200) > 1e-9 {
+				t.Fatalf("%s: LL 系数 %g, 期望 200", w.Name, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package transform 提供图像处理和水印算法共用的平面表示、8×8 块 DCT 与小波变换
+package transform
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// Plane 单通道浮点图像平面，按行存储
+type Plane struct {
+	Width, Height int
+	Pix           []float64
+}
+
+// NewPlane 创建全零平面
+func NewPlane(width, height int) *Plane {
+	return &Plane{Width: width, Height: height, Pix: make([]float64, width*height)}
+}
+
+// At 返回 (x, y) 处的值
+func (p *Plane) At(x, y int) float64 {
+	return p.Pix[y*p.Width+x]
+}
+
+// Set 设置 (x, y) 处的值
+func (p *Plane) Set(x, y int, v float64) {
+	p.Pix[y*p.Width+x] = v
+}
+
+// Clone 复制平面
+func (p *Plane) Clone() *Plane {
+	return &Plane{Width: p.Width, Height: p.Height, Pix: append([]float64(nil), p.Pix...)}
+}
+
+// ToYCbCr 按 BT.601 全范围将图片拆分为 Y、Cb、Cr 三个平面（取值 0-255）
+func ToYCbCr(img image.Image) (y, cb, cr *Plane) {
+	src := imaging.Clone(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	y, cb, cr = NewPlane(w, h), NewPlane(w, h), NewPlane(w, h)
+	for i := range y.Pix {
+		p := src.Pix[4*i:]
+		r, g, b := float64(p[0]), float64(p[1]), float64(p[2])
+		y.Pix[i] = 0.299*r + 0.587*g + 0.114*b
+		cb.Pix[i] = 128 - 0.168736*r - 0.331264*g + 0.5*b
+		cr.Pix[i] = 128 + 0.5*r - 0.418688*g - 0.081312*b
+	}
+	return y, cb, cr
+}
+
+// FromYCbCr 将 Y、Cb、Cr 平面合成为不透明图片，超出范围的值被截断
+func FromYCbCr(y, cb, cr *Plane) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, y.Width, y.Height))
+	for i := range y.Pix {
+		yy, u, v := y.Pix[i], cb.Pix[i]-128, cr.Pix[i]-128
+		p := dst.Pix[4*i:]
+		p[0] = ClampUint8(yy + 1.402*v)
+		p[1] = ClampUint8(yy - 0.344136*u - 0.714136*v)
+		p[2] = ClampUint8(yy + 1.772*u)
+		p[3] = 0xff
+	}
+	return dst
+}
+
+// ClampUint8 四舍五入并截断到 0-255
+func ClampUint8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
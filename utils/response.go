@@ -1,19 +1,24 @@
 package utils
 
 import (
+	"bytes"
 	"image"
-	"image/jpeg"
-	"image/png"
+	"io"
 	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Neurocoda/Antimg/codec"
+	"github.com/Neurocoda/Antimg/config"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/image/bmp"
 )
 
 type Response struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Code      int         `json:"code"`
+	ErrorCode string      `json:"error_code,omitempty"` // 机器可读的错误码，便于客户端区分错误类型
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
 }
 
 func SuccessResponse(c *gin.Context, data interface{}) {
@@ -31,30 +36,100 @@ func ErrorResponse(c *gin.Context, code int, message string) {
 	})
 }
 
-func SendImageResponse(c *gin.Context, format string, img image.Image) {
-	// 设置下载头部，强制下载而不是在浏览器中显示
-	filename := "processed_image." + format
-	if format == "jpg" {
-		filename = "processed_image.jpeg"
+// ErrorResponseWithCode 返回带错误码的错误响应
+func ErrorResponseWithCode(c *gin.Context, code int, errorCode, message string) {
+	c.JSON(code, Response{
+		Code:      code,
+		ErrorCode: errorCode,
+		Message:   message,
+	})
+}
+
+// ImageFilename 由上传文件名生成处理结果的文件名：原始文件名 + OUTPUT_SUFFIX + 扩展名，
+// 输出格式与原扩展名一致时保留原扩展名，如 IMG_1234.JPG -> IMG_1234_antimg.JPG
+func ImageFilename(original, format string) string {
+	name := path.Base(strings.ReplaceAll(original, "\\", "/"))
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" || base == "." || base == "/" {
+		base = "image"
 	}
 
-	c.Writer.Header().Set("Content-Type", "application/octet-stream")
-	c.Writer.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
+	if parsed, err := codec.ParseFormat(ext); err != nil || parsed != format {
+		ext = "." + codec.Extension(format)
+	}
+	return base + config.AppConfig.OutputSuffix + ext
+}
+
+// ContentDisposition 生成 Content-Disposition 头；文件名含非ASCII字符时
+// 附加 RFC 5987 编码的 filename* 参数，filename 参数保留ASCII回退名称
+func ContentDisposition(disposition, filename string) string {
+	fallback := make([]byte, 0, len(filename))
+	for _, r := range filename {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' {
+			fallback = append(fallback, '_')
+			continue
+		}
+		fallback = append(fallback, byte(r))
+	}
+
+	value := disposition + "; filename=\"" + string(fallback) + "\""
+	if string(fallback) != filename {
+		value += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return value
+}
 
-	switch format {
-	case "jpeg", "jpg":
-		jpeg.Encode(c.Writer, img, &jpeg.Options{Quality: 90})
-	case "png":
-		png.Encode(c.Writer, img)
-	case "bmp":
-		// BMP输出
-		bmp.Encode(c.Writer, img)
-	case "webp":
-		// WebP格式转换为JPEG输出（因为Go标准库不支持WebP编码）
-		jpeg.Encode(c.Writer, img, &jpeg.Options{Quality: 90})
-	default:
-		// 默认使用JPEG格式输出
-		jpeg.Encode(c.Writer, img, &jpeg.Options{Quality: 90})
+// encodeRFC5987 按 RFC 5987 attr-char 规则百分号编码
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
 	}
+	return b.String()
+}
+
+// EncodeImage 按输出参数编码图片，format 为输入图片的格式
+func EncodeImage(w io.Writer, format string, img image.Image, opts codec.Options) error {
+	return codec.Encode(w, opts.OutputFormat(format), img, opts)
+}
+
+// SendImageResponse 返回处理后的图片，Content-Type 与实际编码格式一致；
+// original 为上传的文件名，disposition 为 attachment 或 inline。
+// 先编码到内存再写响应，编码失败（如 WebP 超出尺寸上限）时返回500
+func SendImageResponse(c *gin.Context, original, disposition, format string, img image.Image, opts codec.Options) {
+	var buf bytes.Buffer
+	if err := EncodeImage(&buf, format, img, opts); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "图片编码失败: "+err.Error())
+		return
+	}
+	SendEncodedImage(c, original, disposition, format, buf.Bytes(), opts)
+}
+
+// SendEncodedImage 返回已按 opts 编码好的图片 data，其余同 SendImageResponse
+func SendEncodedImage(c *gin.Context, original, disposition, format string, data []byte, opts codec.Options) {
+	setImageHeaders(c, original, disposition, format, opts)
+	c.Writer.Write(data)
+}
+
+// setImageHeaders 设置图片响应的类型、文件名和元数据相关响应头
+func setImageHeaders(c *gin.Context, original, disposition, format string, opts codec.Options) {
+	outputFormat := opts.OutputFormat(format)
+	filename := ImageFilename(original, outputFormat)
+
+	c.Writer.Header().Set("Content-Type", codec.MIMEType(outputFormat))
+	c.Writer.Header().Set("Content-Disposition", ContentDisposition(disposition, filename))
+	c.Writer.Header().Set("X-Antimg-Metadata", string(codec.EffectivePolicy(outputFormat, opts.MetadataPolicy)))
+	if opts.ICCMode != "" {
+		c.Writer.Header().Set("X-Antimg-ICC", string(opts.ICCMode))
+	}
+	c.Writer.Header().Set("Cache-Control", "no-cache")
 }
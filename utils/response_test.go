@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Neurocoda/Antimg/codec"
+	"github.com/Neurocoda/Antimg/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSendImageResponseEncodeError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{OutputSuffix: "_antimg"}
+
+	for _, tc := range []struct {
+		name  string
+		width int
+		code  int
+	}{
+		{"ok", 16, http.StatusOK},
+		{"webp-too-wide", 16385, http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			img := image.NewNRGBA(image.Rect(0, 0, tc.width, 1))
+
+			SendImageResponse(c, "a.png", "attachment", "png", img, codec.Options{Format: "webp"})
+			if w.Code != tc.code {
+				t.Fatalf("status = %d, 期望 %d", w.Code, tc.code)
+			}
+			if tc.code != http.StatusOK {
+				// 编码失败时返回 JSON 错误，不能带上图片的响应头
+				if ct := w.Header().Get("Content-Type"); ct == "image/webp" {
+					t.Errorf("编码失败时 Content-Type = %q", ct)
+				}
+				if w.Header().Get("Content-Disposition") != "" {
+					t.Error("编码失败时不应设置 Content-Disposition")
+				}
+			} else if ct := w.Header().Get("Content-Type"); ct != "image/webp" {
+				t.Errorf("Content-Type = %q, 期望 image/webp", ct)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package watermark
+
+import (
+	"image"
+
+	"github.com/Neurocoda/Antimg/transform"
+)
+
+const (
+	// dctStrength 两个中频系数之差的最小幅度，决定水印强度
+	dctStrength = 12
+	// 承载比特的中频系数对 (u=3, v=2) 和 (u=2, v=3)，对称位置受 JPEG 量化的影响相近
+	dctCoeffA = 2*transform.BlockSize + 3
+	dctCoeffB = 3*transform.BlockSize + 2
+)
+
+// dctScheme 在亮度 8×8 块 DCT 的一对中频系数之间嵌入比特：
+// 比特为1时令 A-B ≥ dctStrength，为0时令 A-B ≤ -dctStrength。
+// 能够承受 JPEG 压缩和轻微噪声，但依赖块对齐
+type dctScheme struct{}
+
+func (dctScheme) Name() string { return "dct" }
+
+func (dctScheme) Capacity(width, height int) int {
+	return (width / transform.BlockSize) * (height / transform.BlockSize)
+}
+
+func (s dctScheme) Embed(img image.Image, bits []bool, key int64) (image.Image, error) {
+	if err := checkCapacity(s, img, len(bits)); err != nil {
+		return nil, err
+	}
+	y, _, _ := transform.ToYCbCr(img)
+	marked := y.Clone()
+	bw, bh := y.Blocks()
+
+	var block transform.Block
+	for i, sl := range layout(bw*bh, len(bits), key) {
+		sign := -1.0
+		if bits[sl.bit] != sl.flip {
+			sign = 1
+		}
+		marked.ReadBlock(i%bw, i/bw, &block)
+		block.DCT()
+		if d := sign * (block[dctCoeffA] - block[dctCoeffB]); d < dctStrength {
+			delta := (dctStrength - d) / 2
+			block[dctCoeffA] += sign * delta
+			block[dctCoeffB] -= sign * delta
+		}
+		block.IDCT()
+		marked.WriteBlock(i%bw, i/bw, &block)
+	}
+	return applyLumaDelta(img, y, marked), nil
+}
+
+func (s dctScheme) Extract(img image.Image, n int, key int64) ([]bool, error) {
+	if err := checkCapacity(s, img, n); err != nil {
+		return nil, err
+	}
+	y, _, _ := transform.ToYCbCr(img)
+	bw, bh := y.Blocks()
+
+	scores := make([]float64, n)
+	var block transform.Block
+	for i, sl := range layout(bw*bh, n, key) {
+		y.ReadBlock(i%bw, i/bw, &block)
+		block.DCT()
+		// 限制单个块的贡献，避免纹理强烈的块主导判决
+		d := min(max(block[dctCoeffA]-block[dctCoeffB], -3*dctStrength), 3*dctStrength)
+		if sl.flip {
+			d = -d
+		}
+		scores[sl.bit] += float64(d)
+	}
+	return decide(scores), nil
+}
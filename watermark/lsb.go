@@ -0,0 +1,48 @@
+package watermark
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// lsbScheme 在绿色通道最低有效位中嵌入比特，每个像素为一个嵌入单元
+// 不可见但极其脆弱，任何重新量化或几何变换都会破坏它，作为攻击效果的下限参考
+type lsbScheme struct{}
+
+func (lsbScheme) Name() string { return "lsb" }
+
+func (lsbScheme) Capacity(width, height int) int { return width * height }
+
+func (s lsbScheme) Embed(img image.Image, bits []bool, key int64) (image.Image, error) {
+	if err := checkCapacity(s, img, len(bits)); err != nil {
+		return nil, err
+	}
+	dst := imaging.Clone(img)
+	for i, sl := range layout(len(dst.Pix)/4, len(bits), key) {
+		v := bits[sl.bit] != sl.flip
+		g := &dst.Pix[4*i+1]
+		*g &^= 1
+		if v {
+			*g |= 1
+		}
+	}
+	return dst, nil
+}
+
+func (s lsbScheme) Extract(img image.Image, n int, key int64) ([]bool, error) {
+	if err := checkCapacity(s, img, n); err != nil {
+		return nil, err
+	}
+	src := imaging.Clone(img)
+	scores := make([]float64, n)
+	for i, sl := range layout(len(src.Pix)/4, n, key) {
+		v := src.Pix[4*i+1]&1 == 1
+		if v != sl.flip {
+			scores[sl.bit]++
+		} else {
+			scores[sl.bit]--
+		}
+	}
+	return decide(scores), nil
+}
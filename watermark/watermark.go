@@ -0,0 +1,156 @@
+// Package watermark 提供用于评估攻击效果的参考盲水印算法（DCT、DWT、LSB）
+// 各算法只需密钥即可提取水印，不需要原图
+package watermark
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math/rand"
+	"sort"
+
+	"github.com/Neurocoda/Antimg/transform"
+	"github.com/disintegration/imaging"
+)
+
+// DetectionThreshold 误码率不超过该值时认为水印仍可检测
+// 64位载荷下随机比特达到该误码率的概率低于 1e-7
+const DetectionThreshold = 0.15
+
+// Scheme 盲水印算法，嵌入位置和扰动由密钥决定
+type Scheme interface {
+	Name() string
+	// Capacity 返回给定尺寸图片可用的嵌入单元数，载荷比特在单元间重复嵌入
+	Capacity(width, height int) int
+	Embed(img image.Image, bits []bool, key int64) (image.Image, error)
+	Extract(img image.Image, n int, key int64) ([]bool, error)
+}
+
+var registry = map[string]Scheme{}
+
+// register 注册水印算法
+func register(s Scheme) {
+	registry[s.Name()] = s
+}
+
+func init() {
+	register(dctScheme{})
+	register(dwtScheme{})
+	register(lsbScheme{})
+}
+
+// Get 按名称查找水印算法
+func Get(name string) (Scheme, bool) {
+	s, ok := registry[name]
+	return s, ok
+}
+
+// Names 返回所有水印算法名称（已排序）
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CapacityError 图片太小，嵌入单元数不足以容纳载荷
+type CapacityError struct {
+	Scheme   string
+	Capacity int // 图片可用的嵌入单元数
+	Bits     int // 载荷位数
+}
+
+func (e *CapacityError) Error() string {
+	return fmt.Sprintf("图片太小，%s 水印最多嵌入 %d 位，载荷为 %d 位", e.Scheme, e.Capacity, e.Bits)
+}
+
+// checkCapacity 检查嵌入单元数是否足以容纳载荷
+func checkCapacity(s Scheme, img image.Image, n int) error {
+	if n <= 0 {
+		return errors.New("水印载荷不能为空")
+	}
+	b := img.Bounds()
+	if c := s.Capacity(b.Dx(), b.Dy()); c < n {
+		return &CapacityError{Scheme: s.Name(), Capacity: c, Bits: n}
+	}
+	return nil
+}
+
+// slot 单个嵌入单元承载的比特及其白化符号
+type slot struct {
+	bit  int  // 承载的载荷比特序号
+	flip bool // 为 true 时嵌入取反后的比特，使嵌入图案与载荷内容无关
+}
+
+// layout 按密钥将 n 位载荷分配到 count 个嵌入单元，每位重复约 count/n 次
+func layout(count, n int, key int64) []slot {
+	rng := rand.New(rand.NewSource(key))
+	perm := rng.Perm(count)
+	slots := make([]slot, count)
+	for i, p := range perm {
+		slots[p] = slot{bit: i % n, flip: rng.Intn(2) == 1}
+	}
+	return slots
+}
+
+// decide 按各比特累计的软判决得分输出比特，得分为正表示1
+func decide(scores []float64) []bool {
+	bits := make([]bool, len(scores))
+	for i, s := range scores {
+		bits[i] = s > 0
+	}
+	return bits
+}
+
+// applyLumaDelta 将亮度平面的修改量等量加到 RGB 三个通道上，色度保持不变，透明度不变
+func applyLumaDelta(img image.Image, before, after *transform.Plane) *image.NRGBA {
+	dst := imaging.Clone(img)
+	for i := range before.Pix {
+		d := after.Pix[i] - before.Pix[i]
+		if d == 0 {
+			continue
+		}
+		p := dst.Pix[4*i:]
+		for c := 0; c < 3; c++ {
+			p[c] = transform.ClampUint8(float64(p[c]) + d)
+		}
+	}
+	return dst
+}
+
+// BitsFromBytes 将字节按高位在前展开为比特
+func BitsFromBytes(data []byte) []bool {
+	bits := make([]bool, 0, len(data)*8)
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			bits = append(bits, b>>i&1 == 1)
+		}
+	}
+	return bits
+}
+
+// RandomBits 由密钥生成 n 位伪随机载荷
+func RandomBits(n int, key int64) []bool {
+	rng := rand.New(rand.NewSource(key ^ 0x5bd1e995))
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = rng.Intn(2) == 1
+	}
+	return bits
+}
+
+// BER 计算误码率，长度不一致的部分计为错误
+func BER(want, got []bool) float64 {
+	if len(want) == 0 {
+		return 0
+	}
+	errs := 0
+	for i, b := range want {
+		if i >= len(got) || got[i] != b {
+			errs++
+		}
+	}
+	return float64(errs) / float64(len(want))
+}
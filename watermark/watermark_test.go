@@ -0,0 +1,119 @@
+package watermark
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+// testImage 生成带平滑渐变和纹理的测试图片，接近照片的频谱
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := 128 + 60*math.Sin(float64(x)/23) + 40*math.Cos(float64(y)/17) + 10*math.Sin(float64(x*y)/50)
+			img.SetNRGBA(x, y, color.NRGBA{uint8(v), uint8(255 - v), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+// jpegRoundTrip 按质量 quality 做一次 JPEG 编解码
+func jpegRoundTrip(t *testing.T, img image.Image, quality int) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSchemeRoundTrip(t *testing.T) {
+	const key = 42
+	img := testImage(256, 256)
+	bits := RandomBits(64, key)
+
+	for _, tc := range []struct {
+		scheme     string
+		jpegRobust bool // 是否要求承受质量75的 JPEG
+	}{
+		{"dct", true},
+		{"dwt", true},
+		{"lsb", false},
+	} {
+		t.Run(tc.scheme, func(t *testing.T) {
+			s, ok := Get(tc.scheme)
+			if !ok {
+				t.Fatalf("未注册的水印算法 %s", tc.scheme)
+			}
+			marked, err := s.Embed(img, bits, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := marked.Bounds().Size(); got != img.Bounds().Size() {
+				t.Fatalf("嵌入后尺寸 = %v", got)
+			}
+
+			extract := func(src image.Image) float64 {
+				t.Helper()
+				got, err := s.Extract(src, len(bits), key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return BER(bits, got)
+			}
+
+			// 未受攻击时完整提取
+			if ber := extract(marked); ber != 0 {
+				t.Errorf("未攻击的 BER = %v, 期望 0", ber)
+			}
+			// 未嵌入水印的图片只能得到随机比特
+			if ber := extract(img); ber < 0.3 || ber > 0.7 {
+				t.Errorf("未嵌入水印的 BER = %v, 期望接近 0.5", ber)
+			}
+			// 错误的密钥同样无法提取
+			if got, err := s.Extract(marked, len(bits), key+1); err != nil {
+				t.Fatal(err)
+			} else if ber := BER(bits, got); ber < 0.3 || ber > 0.7 {
+				t.Errorf("错误密钥的 BER = %v, 期望接近 0.5", ber)
+			}
+
+			ber := extract(jpegRoundTrip(t, marked, 75))
+			if tc.jpegRobust && ber > 0.1 {
+				t.Errorf("JPEG q75 后的 BER = %v, 期望远低于 0.5", ber)
+			}
+			if !tc.jpegRobust && ber < 0.3 {
+				t.Errorf("lsb 在 JPEG q75 后的 BER = %v, 期望被破坏", ber)
+			}
+		})
+	}
+}
+
+// 图片容纳不下载荷时返回 *CapacityError，便于调用方区分请求参数问题
+func TestCapacityError(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	bits := RandomBits(64, 1)
+	for _, name := range Names() {
+		s, _ := Get(name)
+		_, embedErr := s.Embed(img, bits, 1)
+		_, extractErr := s.Extract(img, len(bits), 1)
+		for _, err := range []error{embedErr, extractErr} {
+			var capErr *CapacityError
+			if !errors.As(err, &capErr) {
+				t.Errorf("%s: err = %v, 期望 *CapacityError", name, err)
+				continue
+			}
+			if capErr.Scheme != name || capErr.Bits != 64 || capErr.Capacity != s.Capacity(4, 4) {
+				t.Errorf("%s: %+v", name, capErr)
+			}
+		}
+	}
+}